@@ -0,0 +1,132 @@
+package affinity
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sticky sessions for load balanced deployments. Each instance has an ID (INSTANCE_ID) and at login the user is
+// given an affinity cookie naming the instance they logged in on, their "home" instance. Load balancers that support
+// cookie based stickiness can route on it directly.
+// When a WebSocket handshake for a user homed on another instance arrives anyway (e.g. the load balancer isn't
+// sticky, or was reconfigured during a deploy), the instance either reverse proxies the connection to the home
+// instance or redirects the client to it, depending on AFFINITY_MODE. Peer instance URLs are configured with
+// INSTANCE_PEERS as comma separated id=url pairs. If the home instance can't be reached, for example during a
+// rolling deploy, the connection is handled locally and the user is rehomed on this instance.
+
+const CookieName = "instance_affinity"
+
+// Modes for handling connections homed on another instance
+const (
+	ModeProxy    = "proxy"
+	ModeRedirect = "redirect"
+)
+
+// Config holds this instance's ID and how to reach its peers.
+type Config struct {
+	InstanceID string
+	Mode       string
+	SameSite   http.SameSite // Matches the session cookie so the affinity cookie is sent in the same contexts
+	peers      map[string]*url.URL
+}
+
+// LoadConfig reads the affinity config from INSTANCE_ID, INSTANCE_PEERS and AFFINITY_MODE.
+// Affinity is disabled when INSTANCE_ID is not set.
+func LoadConfig() *Config {
+	c := &Config{
+		InstanceID: os.Getenv("INSTANCE_ID"),
+		Mode:       ModeProxy,
+		SameSite:   http.SameSiteStrictMode,
+		peers:      make(map[string]*url.URL),
+	}
+	if os.Getenv("AFFINITY_MODE") == ModeRedirect {
+		c.Mode = ModeRedirect
+	}
+
+	for _, pair := range strings.Split(os.Getenv("INSTANCE_PEERS"), ",") {
+		id, rawURL, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			continue
+		}
+		peerURL, err := url.Parse(rawURL)
+		if err != nil || peerURL.Host == "" {
+			log.Printf("Ignoring invalid peer URL for instance %s: %q", id, rawURL)
+			continue
+		}
+		c.peers[id] = peerURL
+	}
+
+	return c
+}
+
+// Enabled reports whether this instance has an ID to issue affinity cookies for.
+func (c *Config) Enabled() bool {
+	return c.InstanceID != ""
+}
+
+// Cookie returns the affinity cookie homing a user on this instance.
+func (c *Config) Cookie() *http.Cookie {
+	return &http.Cookie{
+		Name:     CookieName,
+		Value:    c.InstanceID,
+		Path:     "/",
+		Expires:  time.Now().Add(24 * time.Hour),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: c.SameSite,
+	}
+}
+
+// home returns the ID of the instance a request is homed on, or "" if it has no affinity cookie.
+func home(r *http.Request) string {
+	cookie, err := r.Cookie(CookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// ResponseHeader returns headers for a WebSocket upgrade response, rehoming the user on this instance if their
+// affinity cookie names a different one.
+func (c *Config) ResponseHeader(r *http.Request) http.Header {
+	if !c.Enabled() || home(r) == c.InstanceID {
+		return nil
+	}
+
+	header := http.Header{}
+	header.Add("Set-Cookie", c.Cookie().String())
+	return header
+}
+
+// Middleware sends requests homed on a known peer instance to that instance, handling everything else locally.
+func (c *Config) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		homeID := home(r)
+		peer, known := c.peers[homeID]
+		if !c.Enabled() || homeID == c.InstanceID || !known {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if c.Mode == ModeRedirect {
+			target := *peer
+			target.Path = r.URL.Path
+			target.RawQuery = r.URL.RawQuery
+			http.Redirect(w, r, target.String(), http.StatusTemporaryRedirect)
+			return
+		}
+
+		proxy := httputil.NewSingleHostReverseProxy(peer)
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			// Home instance is unavailable, e.g. restarting during a deploy, so take the connection over
+			log.Printf("Home instance %s unavailable, handling connection locally: %v", homeID, err)
+			next.ServeHTTP(w, r)
+		}
+		proxy.ServeHTTP(w, r)
+	})
+}
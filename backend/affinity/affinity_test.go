@@ -0,0 +1,61 @@
+package affinity
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func newTestConfig(peers map[string]string) *Config {
+	c := &Config{InstanceID: "a", Mode: ModeProxy, peers: make(map[string]*url.URL)}
+	for id, rawURL := range peers {
+		c.peers[id], _ = url.Parse(rawURL)
+	}
+	return c
+}
+
+func serveWithHome(c *Config, homeID string) string {
+	local := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "local")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	if homeID != "" {
+		req.AddCookie(&http.Cookie{Name: CookieName, Value: homeID})
+	}
+	w := httptest.NewRecorder()
+	c.Middleware(local).ServeHTTP(w, req)
+	return w.Body.String()
+}
+
+func TestMiddleware_ProxiesToHomeInstance(t *testing.T) {
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "peer")
+	}))
+	defer peer.Close()
+
+	c := newTestConfig(map[string]string{"b": peer.URL})
+
+	if body := serveWithHome(c, "b"); body != "peer" {
+		t.Errorf("expected connection homed on b to be proxied, got %q", body)
+	}
+	if body := serveWithHome(c, "a"); body != "local" {
+		t.Errorf("expected connection homed here to be handled locally, got %q", body)
+	}
+	if body := serveWithHome(c, ""); body != "local" {
+		t.Errorf("expected connection without affinity to be handled locally, got %q", body)
+	}
+}
+
+func TestMiddleware_FallsBackWhenHomeUnavailable(t *testing.T) {
+	peer := httptest.NewServer(http.NotFoundHandler())
+	peer.Close() // Home instance is down
+
+	c := newTestConfig(map[string]string{"b": peer.URL})
+
+	if body := serveWithHome(c, "b"); body != "local" {
+		t.Errorf("expected fallback to local handling, got %q", body)
+	}
+}
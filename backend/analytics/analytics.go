@@ -0,0 +1,257 @@
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	mathrand "math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Product analytics. Handlers track events such as a message being sent, which are sampled, scrubbed of personal data
+// and queued, then delivered to a sink in batches in the background. Analytics must never slow the chat down, so
+// events are dropped rather than waited on when the queue is full or the sink is failing.
+//
+// Configured with:
+//   - ANALYTICS_SINK: stdout, http or kafka. Analytics are off when unset
+//   - ANALYTICS_HTTP_URL: the collector events are POSTed to, for the http sink
+//   - ANALYTICS_KAFKA_TOPIC: the topic for the kafka sink (default chat-analytics), on the KAFKA_BROKERS cluster
+//   - ANALYTICS_SAMPLE_RATE: share of events kept, from 0 to 1 (default 1)
+//   - ANALYTICS_SAMPLE_RATES: per event overrides, e.g. message_sent=0.1,login=1
+//   - ANALYTICS_PII: how users are identified. pseudonymise (default) replaces user IDs with a keyed hash, drop
+//     leaves them out, and keep sends them as is along with personal properties
+//   - ANALYTICS_SALT: the key for pseudonymised IDs. Random per process if unset, so IDs don't match across restarts
+
+// Events
+const (
+	MessageSent = "message_sent"
+	RoomJoined  = "room_joined"
+	Login       = "login"
+)
+
+// PII modes
+const (
+	PIIPseudonymise = "pseudonymise"
+	PIIDrop         = "drop"
+	PIIKeep         = "keep"
+)
+
+// personalProperties are properties removed from events unless PII is kept
+var personalProperties = []string{"username", "displayName", "email", "ip", "userAgent"}
+
+// Delivery settings
+const (
+	queueSize     = 1000
+	batchSize     = 100
+	flushInterval = 5 * time.Second
+	sendTimeout   = 10 * time.Second
+)
+
+// Event is an analytics event as delivered to the sink.
+type Event struct {
+	Name       string         `json:"event"`
+	TenantID   int            `json:"tenantId"`
+	User       string         `json:"user,omitempty"` // Pseudonymised user ID, the raw ID if PII is kept, empty for guests or if dropped
+	Timestamp  time.Time      `json:"timestamp"`
+	Properties map[string]any `json:"properties,omitempty"`
+}
+
+// Sink receives batches of events.
+type Sink interface {
+	Send(ctx context.Context, events []Event) error
+	Close() error
+}
+
+// Config controls sampling and scrubbing.
+type Config struct {
+	SampleRate  float64            // Share of events kept
+	SampleRates map[string]float64 // Per event overrides of SampleRate
+	PII         string
+	Salt        []byte
+}
+
+// Pipeline samples, scrubs and queues events for delivery to a sink. A nil *Pipeline discards events.
+type Pipeline struct {
+	sink    Sink
+	config  Config
+	events  chan Event
+	dropped atomic.Int64
+}
+
+// New creates a pipeline delivering to a sink. Run must be called to deliver queued events.
+func New(sink Sink, config Config) *Pipeline {
+	return &Pipeline{sink: sink, config: config, events: make(chan Event, queueSize)}
+}
+
+// Load creates a pipeline from the environment, returning nil if analytics are off.
+func Load() (*Pipeline, error) {
+	sink, err := loadSink()
+	if err != nil || sink == nil {
+		return nil, err
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return New(sink, config), nil
+}
+
+// LoadConfig reads the sampling and scrubbing settings from the environment.
+func LoadConfig() (Config, error) {
+	config := Config{SampleRate: 1, SampleRates: make(map[string]float64), PII: PIIPseudonymise}
+
+	if value := os.Getenv("ANALYTICS_SAMPLE_RATE"); value != "" {
+		rate, err := parseRate(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("ANALYTICS_SAMPLE_RATE %w", err)
+		}
+		config.SampleRate = rate
+	}
+	for _, entry := range strings.Split(os.Getenv("ANALYTICS_SAMPLE_RATES"), ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(entry, "=")
+		rate, err := parseRate(value)
+		if err != nil {
+			return Config{}, fmt.Errorf("ANALYTICS_SAMPLE_RATES %s %w", strings.TrimSpace(name), err)
+		}
+		config.SampleRates[strings.TrimSpace(name)] = rate
+	}
+
+	switch mode := os.Getenv("ANALYTICS_PII"); mode {
+	case "", PIIPseudonymise:
+	case PIIDrop, PIIKeep:
+		config.PII = mode
+	default:
+		return Config{}, fmt.Errorf("ANALYTICS_PII must be %s, %s or %s, got %q", PIIPseudonymise, PIIDrop, PIIKeep, mode)
+	}
+
+	config.Salt = []byte(os.Getenv("ANALYTICS_SALT"))
+	if config.PII == PIIPseudonymise && len(config.Salt) == 0 {
+		log.Printf("ANALYTICS_SALT isn't set, so pseudonymised user IDs won't match across restarts")
+		config.Salt = make([]byte, 32)
+		rand.Read(config.Salt)
+	}
+	return config, nil
+}
+
+func parseRate(value string) (float64, error) {
+	rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("must be a number from 0 to 1, got %q", value)
+	}
+	return rate, nil
+}
+
+// Track queues an event for a user, who is 0 for guests. Properties must not include message content.
+func (p *Pipeline) Track(name string, tenantID, userID int, properties map[string]any) {
+	if p == nil || !p.sampled(name) {
+		return
+	}
+
+	event := p.scrub(Event{Name: name, TenantID: tenantID, Timestamp: time.Now().UTC(), Properties: properties}, userID)
+	select {
+	case p.events <- event:
+	default:
+		// Logged on the first drop and every thousandth after, so a failing sink doesn't flood the logs too
+		if dropped := p.dropped.Add(1); dropped%1000 == 1 {
+			log.Printf("Analytics queue full, %d events dropped so far", dropped)
+		}
+	}
+}
+
+// sampled decides whether to keep an event.
+func (p *Pipeline) sampled(name string) bool {
+	rate, ok := p.config.SampleRates[name]
+	if !ok {
+		rate = p.config.SampleRate
+	}
+	return rate >= 1 || mathrand.Float64() < rate
+}
+
+// scrub identifies the user and removes personal properties according to the PII mode.
+func (p *Pipeline) scrub(event Event, userID int) Event {
+	if userID != 0 {
+		switch p.config.PII {
+		case PIIKeep:
+			event.User = strconv.Itoa(userID)
+		case PIIPseudonymise:
+			event.User = Pseudonymise(p.config.Salt, event.TenantID, userID)
+		}
+	}
+
+	if p.config.PII != PIIKeep && len(event.Properties) > 0 {
+		properties := make(map[string]any, len(event.Properties))
+		for key, value := range event.Properties {
+			properties[key] = value
+		}
+		for _, key := range personalProperties {
+			delete(properties, key)
+		}
+		event.Properties = properties
+	}
+	return event
+}
+
+// Pseudonymise derives a stable ID for a user that can't be linked back to them without the salt.
+func Pseudonymise(salt []byte, tenantID, userID int) string {
+	mac := hmac.New(sha256.New, salt)
+	fmt.Fprintf(mac, "%d:%d", tenantID, userID)
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// Run delivers queued events in batches until the context is cancelled, then delivers what's left and closes the sink.
+func (p *Pipeline) Run(ctx context.Context) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Event, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		sendCtx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		defer cancel()
+		if err := p.sink.Send(sendCtx, batch); err != nil {
+			log.Printf("Failed to send %d analytics events: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case event := <-p.events:
+			batch = append(batch, event)
+			if len(batch) == batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			for {
+				select {
+				case event := <-p.events:
+					batch = append(batch, event)
+					if len(batch) == batchSize {
+						flush()
+					}
+				default:
+					flush()
+					if err := p.sink.Close(); err != nil {
+						log.Printf("Failed to close analytics sink: %v", err)
+					}
+					return
+				}
+			}
+		}
+	}
+}
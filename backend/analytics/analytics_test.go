@@ -0,0 +1,182 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// memorySink records the events it's sent.
+type memorySink struct {
+	mu     sync.Mutex
+	events []Event
+	closed bool
+}
+
+func (s *memorySink) Send(ctx context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *memorySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// runUntilDrained runs the pipeline until everything already queued has been delivered.
+func runUntilDrained(p *Pipeline) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p.Run(ctx)
+}
+
+func TestTrack_PIIModes(t *testing.T) {
+	salt := []byte("salt")
+	properties := map[string]any{"username": "alice", "ip": "203.0.113.1", "method": "password"}
+
+	tests := []struct {
+		mode     string
+		wantUser string
+		wantPII  bool
+	}{
+		{PIIPseudonymise, Pseudonymise(salt, 1, 42), false},
+		{PIIDrop, "", false},
+		{PIIKeep, "42", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			sink := &memorySink{}
+			p := New(sink, Config{SampleRate: 1, PII: tt.mode, Salt: salt})
+			p.Track(Login, 1, 42, properties)
+			runUntilDrained(p)
+
+			if len(sink.events) != 1 {
+				t.Fatalf("got %d events, want 1", len(sink.events))
+			}
+			event := sink.events[0]
+			if event.User != tt.wantUser {
+				t.Errorf("User = %q, want %q", event.User, tt.wantUser)
+			}
+			if _, ok := event.Properties["username"]; ok != tt.wantPII {
+				t.Errorf("username property present = %t, want %t", ok, tt.wantPII)
+			}
+			if event.Properties["method"] != "password" {
+				t.Errorf("non-personal property was removed: %v", event.Properties)
+			}
+		})
+	}
+
+	// The caller's properties aren't modified
+	if _, ok := properties["username"]; !ok {
+		t.Error("scrubbing modified the caller's properties")
+	}
+}
+
+func TestPseudonymise(t *testing.T) {
+	salt := []byte("salt")
+	if Pseudonymise(salt, 1, 42) != Pseudonymise(salt, 1, 42) {
+		t.Error("pseudonymised IDs should be stable")
+	}
+	if Pseudonymise(salt, 1, 42) == Pseudonymise(salt, 2, 42) {
+		t.Error("the same user ID in different tenants should get different IDs")
+	}
+	if Pseudonymise(salt, 1, 42) == Pseudonymise([]byte("other"), 1, 42) {
+		t.Error("pseudonymised IDs should depend on the salt")
+	}
+}
+
+func TestTrack_Sampling(t *testing.T) {
+	sink := &memorySink{}
+	p := New(sink, Config{SampleRate: 1, SampleRates: map[string]float64{MessageSent: 0}, PII: PIIDrop})
+	for range 10 {
+		p.Track(MessageSent, 1, 1, nil)
+		p.Track(Login, 1, 1, nil)
+	}
+	runUntilDrained(p)
+
+	for _, event := range sink.events {
+		if event.Name == MessageSent {
+			t.Fatal("event sampled at 0 was delivered")
+		}
+	}
+	if len(sink.events) != 10 {
+		t.Errorf("got %d events, want the 10 logins", len(sink.events))
+	}
+	if !sink.closed {
+		t.Error("sink wasn't closed when the pipeline stopped")
+	}
+}
+
+func TestTrack_Nil(t *testing.T) {
+	var p *Pipeline
+	p.Track(Login, 1, 1, nil) // Must not panic
+}
+
+func TestLoadConfig(t *testing.T) {
+	t.Setenv("ANALYTICS_SAMPLE_RATE", "0.5")
+	t.Setenv("ANALYTICS_SAMPLE_RATES", "message_sent=0.1")
+	t.Setenv("ANALYTICS_PII", "drop")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if config.SampleRate != 0.5 || config.SampleRates[MessageSent] != 0.1 || config.PII != PIIDrop {
+		t.Errorf("unexpected config %+v", config)
+	}
+
+	t.Setenv("ANALYTICS_SAMPLE_RATE", "2")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected an error for a sample rate over 1")
+	}
+	t.Setenv("ANALYTICS_SAMPLE_RATE", "")
+	t.Setenv("ANALYTICS_PII", "everything")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("expected an error for an unknown PII mode")
+	}
+}
+
+func TestWriterSink(t *testing.T) {
+	var b bytes.Buffer
+	sink := NewWriterSink(&b)
+	sink.Send(context.Background(), []Event{{Name: Login, TenantID: 1}, {Name: MessageSent, TenantID: 1}})
+
+	lines := bytes.Split(bytes.TrimSpace(b.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2", len(lines))
+	}
+	var event Event
+	if err := json.Unmarshal(lines[0], &event); err != nil || event.Name != Login {
+		t.Errorf("first line = %s, want a login event", lines[0])
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var received []Event
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL)
+	if err := sink.Send(context.Background(), []Event{{Name: Login, TenantID: 1}}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if len(received) != 1 || received[0].Name != Login {
+		t.Errorf("collector received %v", received)
+	}
+
+	status = http.StatusInternalServerError
+	if err := sink.Send(context.Background(), []Event{{Name: Login}}); err == nil {
+		t.Error("expected an error when the collector fails")
+	}
+}
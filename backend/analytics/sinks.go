@@ -0,0 +1,152 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// loadSink creates the sink named by ANALYTICS_SINK, returning nil if it isn't set.
+func loadSink() (Sink, error) {
+	switch sink := os.Getenv("ANALYTICS_SINK"); sink {
+	case "":
+		return nil, nil
+	case "stdout":
+		return NewWriterSink(os.Stdout), nil
+	case "http":
+		url := os.Getenv("ANALYTICS_HTTP_URL")
+		if url == "" {
+			return nil, fmt.Errorf("ANALYTICS_HTTP_URL is required for the http analytics sink")
+		}
+		return NewHTTPSink(url), nil
+	case "kafka":
+		brokers := os.Getenv("KAFKA_BROKERS")
+		if brokers == "" {
+			return nil, fmt.Errorf("KAFKA_BROKERS is required for the kafka analytics sink")
+		}
+		topic := os.Getenv("ANALYTICS_KAFKA_TOPIC")
+		if topic == "" {
+			topic = "chat-analytics"
+		}
+		return NewKafkaSink(strings.Split(brokers, ","), topic), nil
+	default:
+		return nil, fmt.Errorf("unknown analytics sink %q", sink)
+	}
+}
+
+// WriterSink writes events as NDJSON, e.g. to stdout for a log shipper to collect.
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterSink creates a sink writing to w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+// Send writes a batch of events, one per line.
+func (s *WriterSink) Send(ctx context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	encoder := json.NewEncoder(s.w)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("failed to write analytics event: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close does nothing, as the writer is owned by the caller.
+func (s *WriterSink) Close() error {
+	return nil
+}
+
+// HTTPSink POSTs batches of events to a collector as a JSON array.
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink creates a sink posting to a collector URL.
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{url: url, client: &http.Client{}}
+}
+
+// Send posts a batch of events, failing unless the collector accepts them with a 2xx status.
+func (s *HTTPSink) Send(ctx context.Context, events []Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return fmt.Errorf("failed to encode analytics events: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create analytics request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post analytics events: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("analytics collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Close closes idle connections to the collector.
+func (s *HTTPSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// KafkaSink publishes events to a Kafka topic, keyed by tenant.
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaSink creates a sink publishing to a topic on the given brokers.
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireOne, // Analytics can tolerate the rare loss for lower latency
+		},
+	}
+}
+
+// Send publishes a batch of events.
+func (s *KafkaSink) Send(ctx context.Context, events []Event) error {
+	records := make([]kafka.Message, 0, len(events))
+	for _, event := range events {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode analytics event: %w", err)
+		}
+		records = append(records, kafka.Message{Key: []byte(strconv.Itoa(event.TenantID)), Value: value})
+	}
+	return s.writer.WriteMessages(ctx, records...)
+}
+
+// Close flushes and closes the Kafka writer.
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,62 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// REST endpoints return errors as a consistent JSON envelope, e.g:
+//
+//	{"code": "invalid_credentials", "message": "Invalid username or password"}
+//
+// The code is stable so frontends and bots can branch on it, while the message is for humans and may change.
+
+// Code identifies the type of error.
+type Code string
+
+const (
+	CodeBadRequest         Code = "bad_request"
+	CodeValidationFailed   Code = "validation_failed"
+	CodeUnauthorised       Code = "unauthorised"
+	CodeInvalidCredentials Code = "invalid_credentials"
+	CodeAccountDeactivated Code = "account_deactivated"
+	CodeForbidden          Code = "forbidden"
+	CodeNotFound           Code = "not_found"
+	CodeMethodNotAllowed   Code = "method_not_allowed"
+	CodeConflict           Code = "conflict"
+	CodePayloadTooLarge    Code = "payload_too_large"
+	CodeTimeout            Code = "timeout"
+	CodeUnknownTenant      Code = "unknown_tenant"
+	CodeServerBusy         Code = "server_busy"
+	CodeInternal           Code = "internal_error"
+)
+
+// Response is the JSON error envelope.
+type Response struct {
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+// Write sends a JSON error response.
+func Write(w http.ResponseWriter, status int, code Code, message string) {
+	WriteDetails(w, status, code, message, nil)
+}
+
+// WriteDetails sends a JSON error response with extra details, such as field-level validation errors.
+func WriteDetails(w http.ResponseWriter, status int, code Code, message string, details any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{Code: code, Message: message, Details: details})
+}
+
+// MethodNotAllowed sends the error for a request using an unsupported method.
+func MethodNotAllowed(w http.ResponseWriter) {
+	Write(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+}
+
+// Unauthorised sends the error for a request that failed authorisation.
+func Unauthorised(w http.ResponseWriter) {
+	Write(w, http.StatusUnauthorized, CodeUnauthorised, "Unauthorised")
+}
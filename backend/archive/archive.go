@@ -0,0 +1,185 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"go-chat-app/db"
+	"go-chat-app/models"
+	"go-chat-app/tracing"
+)
+
+// Default archiver settings
+const (
+	archiveInterval = time.Hour
+	batchSize       = 1000
+	defaultMaxAge   = 90 * 24 * time.Hour
+)
+
+// Store saves and loads archive objects, e.g. in an S3 bucket.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// Archiver moves messages older than a maximum age out of the database into cold storage.
+// Each run writes a tenant's old messages as a page of gzipped NDJSON, records the page, and only then deletes the
+// messages, so an interrupted run archives the same messages again rather than losing them.
+type Archiver struct {
+	db        db.DBInterface
+	store     Store
+	maxAge    time.Duration
+	batchSize int
+}
+
+// NewArchiver creates an archiver for messages older than ARCHIVE_MAX_AGE_DAYS (default 90).
+func NewArchiver(database db.DBInterface, store Store) *Archiver {
+	maxAge := defaultMaxAge
+	if days, err := strconv.Atoi(os.Getenv("ARCHIVE_MAX_AGE_DAYS")); err == nil && days > 0 {
+		maxAge = time.Duration(days) * 24 * time.Hour
+	}
+
+	return &Archiver{
+		db:        database,
+		store:     store,
+		maxAge:    maxAge,
+		batchSize: batchSize,
+	}
+}
+
+// Start periodically archives old messages until the context is cancelled.
+func (a *Archiver) Start(ctx context.Context) {
+	ticker := time.NewTicker(archiveInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep archiving straight away while there is a backlog
+		n, err := a.archiveOnce(ctx, time.Now())
+		if err != nil {
+			log.Printf("Failed to archive messages: %v", err)
+		}
+		if err == nil && n == a.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// archiveOnce archives the next batch of messages that are too old to keep and returns how many were archived.
+func (a *Archiver) archiveOnce(ctx context.Context, now time.Time) (int, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "archive.archiveOnce")
+	defer span.End()
+
+	cutoff := now.Add(-a.maxAge)
+	messages, err := a.db.GetMessagesBefore(cutoff, a.batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	// Each tenant's messages are archived to their own page
+	var tenantOrder []int
+	byTenant := make(map[int][]models.Message)
+	for _, msg := range messages {
+		if _, ok := byTenant[msg.TenantID]; !ok {
+			tenantOrder = append(tenantOrder, msg.TenantID)
+		}
+		byTenant[msg.TenantID] = append(byTenant[msg.TenantID], msg)
+	}
+
+	archived := 0
+	for _, tenantID := range tenantOrder {
+		if err := a.archivePage(ctx, tenantID, byTenant[tenantID], cutoff); err != nil {
+			return archived, err
+		}
+		archived += len(byTenant[tenantID])
+	}
+	return archived, nil
+}
+
+// archivePage writes one tenant's messages to the store, records the page and deletes the messages.
+func (a *Archiver) archivePage(ctx context.Context, tenantID int, messages []models.Message, cutoff time.Time) error {
+	first, last := messages[0], messages[len(messages)-1]
+	key := fmt.Sprintf("tenants/%d/messages/%d-%d.ndjson.gz", tenantID, first.ID, last.ID)
+
+	data, err := Encode(messages)
+	if err != nil {
+		return err
+	}
+	if err := a.store.Put(ctx, key, data); err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+
+	err = a.db.SaveMessageArchive(models.MessageArchive{
+		TenantID:       tenantID,
+		ObjectKey:      key,
+		FirstMessageID: first.ID,
+		LastMessageID:  last.ID,
+		From:           first.Timestamp,
+		To:             last.Timestamp,
+		MessageCount:   len(messages),
+	})
+	if err != nil {
+		return err
+	}
+
+	return a.db.DeleteMessagesThrough(tenantID, last.ID, cutoff)
+}
+
+// Encode writes messages as gzipped NDJSON, one message per line.
+func Encode(messages []models.Message) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(gz) // Encode ends each value with a newline
+	for _, msg := range messages {
+		if err := encoder.Encode(msg); err != nil {
+			return nil, fmt.Errorf("failed to encode message %d: %w", msg.ID, err)
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress archive: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode reads messages written by Encode.
+func Decode(data []byte) ([]models.Message, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress archive: %w", err)
+	}
+	defer gz.Close()
+
+	messages := []models.Message{}
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // Allow for long messages
+	for scanner.Scan() {
+		var msg models.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			return nil, fmt.Errorf("failed to decode archived message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, scanner.Err()
+}
+
+// FetchPage loads an archived page of messages from the store.
+func FetchPage(ctx context.Context, store Store, archive models.MessageArchive) ([]models.Message, error) {
+	data, err := store.Get(ctx, archive.ObjectKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", archive.ObjectKey, err)
+	}
+	return Decode(data)
+}
@@ -0,0 +1,54 @@
+package archive
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-chat-app/db"
+	"go-chat-app/models"
+)
+
+type memoryStore map[string][]byte
+
+func (s memoryStore) Put(_ context.Context, key string, data []byte) error {
+	s[key] = data
+	return nil
+}
+
+func (s memoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	return s[key], nil
+}
+
+func TestArchiveOnce_MovesOldMessagesPerTenant(t *testing.T) {
+	mockDB := db.NewMockDB()
+	now := time.Now()
+	old := now.Add(-100 * 24 * time.Hour)
+	mockDB.SaveMessage(models.Message{TenantID: 1, Sender: "user1", Content: "old one", Timestamp: old})
+	mockDB.SaveMessage(models.Message{TenantID: 2, Sender: "user2", Content: "old two", Timestamp: old})
+	mockDB.SaveMessage(models.Message{TenantID: 1, Sender: "user1", Content: "recent", Timestamp: now})
+
+	store := memoryStore{}
+	archiver := NewArchiver(mockDB, store)
+
+	n, err := archiver.archiveOnce(context.Background(), now)
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 messages archived, got %d (%v)", n, err)
+	}
+
+	// Only the recent message is left in the database
+	history, _ := mockDB.GetChatHistory(1)
+	if len(history) != 1 || history[0].Content != "recent" {
+		t.Errorf("expected only the recent message to remain, got %+v", history)
+	}
+
+	// The archived page can be fetched back from the store
+	archives, _ := mockDB.GetMessageArchives(1)
+	if len(archives) != 1 || archives[0].MessageCount != 1 {
+		t.Fatalf("expected one archive page for tenant 1, got %+v", archives)
+	}
+	messages, err := FetchPage(context.Background(), store, archives[0])
+	if err != nil || len(messages) != 1 || messages[0].Content != "old one" {
+		t.Errorf("expected archived message, got %+v (%v)", messages, err)
+	}
+}
@@ -0,0 +1,66 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Store stores archive objects in an S3 or S3-compatible (e.g. MinIO) bucket.
+type S3Store struct {
+	client *s3.Client
+	bucket string
+}
+
+// LoadS3Store creates a store for the bucket in ARCHIVE_S3_BUCKET, or returns nil if archiving isn't configured.
+// Credentials and region come from the standard AWS environment variables. ARCHIVE_S3_ENDPOINT points the client at an
+// S3-compatible service instead of AWS, using path-style addressing.
+func LoadS3Store(ctx context.Context) (*S3Store, error) {
+	bucket := os.Getenv("ARCHIVE_S3_BUCKET")
+	if bucket == "" {
+		return nil, nil
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint := os.Getenv("ARCHIVE_S3_ENDPOINT"); endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+			o.UsePathStyle = true
+		}
+	})
+	return &S3Store{client: client, bucket: bucket}, nil
+}
+
+// Put uploads an archive object.
+func (s *S3Store) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/gzip"),
+	})
+	return err
+}
+
+// Get downloads an archive object.
+func (s *S3Store) Get(ctx context.Context, key string) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
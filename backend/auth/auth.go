@@ -9,10 +9,20 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
+	"go-chat-app/affinity"
+	"go-chat-app/analytics"
+	"go-chat-app/apierror"
+	"go-chat-app/clock"
 	"go-chat-app/db"
 	"go-chat-app/models"
+	"go-chat-app/preferences"
+	"go-chat-app/tenants"
+	"go-chat-app/usernames"
+	"go-chat-app/utils"
+	"go-chat-app/validation"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -22,40 +32,115 @@ type AuthServiceInterface interface {
 	Register(w http.ResponseWriter, r *http.Request)
 	LoginUser(w http.ResponseWriter, r *http.Request)
 	LogoutUser(w http.ResponseWriter, r *http.Request)
+	DeactivateAccount(w http.ResponseWriter, r *http.Request)
 	Profile(w http.ResponseWriter, r *http.Request)
 	Authorise(r *http.Request) (*models.User, error)
+	AuthoriseAdmin(r *http.Request) (*models.User, error)
 	SessionCheck(w http.ResponseWriter, r *http.Request)
 }
 
+// ErrNotAdmin is returned by AuthoriseAdmin when a valid user isn't an admin.
+var ErrNotAdmin = errors.New("admin role required")
+
 type AuthService struct {
-	db db.DBInterface
+	db            db.DBInterface
+	sameSite      http.SameSite
+	usernameRules usernames.Rules
+	affinity      *affinity.Config
+	analytics     *analytics.Pipeline
+	clock         clock.Clock
+}
+
+// Option configures optional AuthService settings.
+type Option func(*AuthService)
+
+// WithSameSite sets the SameSite mode used for the session and CSRF cookies.
+// SameSite=None is needed when the chat is embedded in an iframe on a third-party site.
+func WithSameSite(mode http.SameSite) Option {
+	return func(a *AuthService) {
+		a.sameSite = mode
+	}
+}
+
+// WithUsernameRules sets the rules usernames must follow when registering.
+func WithUsernameRules(rules usernames.Rules) Option {
+	return func(a *AuthService) {
+		a.usernameRules = rules
+	}
+}
+
+// WithAffinity issues an instance affinity cookie at login for sticky sessions.
+func WithAffinity(config *affinity.Config) Option {
+	return func(a *AuthService) {
+		a.affinity = config
+	}
+}
+
+// WithClock sets the clock used for cookie expiry and account timestamps, for tests.
+func WithClock(c clock.Clock) Option {
+	return func(a *AuthService) {
+		a.clock = c
+	}
+}
+
+// WithAnalytics tracks logins in the product analytics pipeline.
+func WithAnalytics(pipeline *analytics.Pipeline) Option {
+	return func(a *AuthService) {
+		a.analytics = pipeline
+	}
+}
+
+func NewAuthService(db db.DBInterface, opts ...Option) *AuthService {
+	a := &AuthService{db: db, sameSite: http.SameSiteStrictMode, usernameRules: usernames.DefaultRules(), clock: clock.System{}}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
-func NewAuthService(db db.DBInterface) *AuthService {
-	return &AuthService{db: db}
+// ParseSameSite converts a config value ("strict", "lax" or "none") into a http.SameSite mode, defaulting to strict.
+func ParseSameSite(value string) http.SameSite {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode // Browsers only accept SameSite=None cookies when Secure is also set
+	default:
+		return http.SameSiteStrictMode
+	}
 }
 
 func (a *AuthService) Register(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		apierror.MethodNotAllowed(w)
+		return
+	}
+
+	v, err := validation.New(r)
+	if err != nil {
+		validation.WriteBodyError(w, err)
 		return
 	}
 
-	username := r.FormValue("username")
-	password := r.FormValue("password")
+	v.Username("username", a.usernameRules)
+	v.Password("password")
+
+	username := v.Get("username") // Normalised by the username check
+	password := v.Get("password")
+	tenantID := tenants.IDFromContext(r.Context())
 
 	log.Printf("Registering username: %s", username)
 
-	if len(username) < 1 || len(password) < 4 {
-		log.Printf("Invalid registration details - username: '%s', password length: %d", username, len(password))
-		http.Error(w, "Invalid username or password (password must be at least 4 characters)", http.StatusNotAcceptable)
+	if !v.Valid() {
+		log.Printf("Invalid registration details - username: '%s', errors: %+v", username, v.Errors())
+		v.WriteError(w, http.StatusNotAcceptable)
 		return
 	}
 
 	// Check if the user already exists
-	if _, err := a.db.GetUserByUsername(username); err == nil {
+	if _, err := a.db.GetUserByUsername(tenantID, username); err == nil {
 		log.Printf("Registration failed: username '%s' already exists", username)
-		http.Error(w, "User already exists", http.StatusConflict)
+		apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "User already exists")
 		return
 	}
 
@@ -63,17 +148,26 @@ func (a *AuthService) Register(w http.ResponseWriter, r *http.Request) {
 	hashedPassword, err := hashPassword(password)
 	if err != nil {
 		log.Printf("Failed to hash password for user '%s': %v", username, err)
-		http.Error(w, "Error processing password", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Error processing password")
 		return
 	}
 
 	log.Println("Saving user...")
 
-	// Save the user to the database
-	err = a.db.SaveUser(username, hashedPassword)
+	// Save the user along with their default preferences, so there is never an account without them
+	err = a.db.WithTx(func(tx db.DBInterface) error {
+		if err := tx.SaveUser(tenantID, username, hashedPassword); err != nil {
+			return err
+		}
+		user, err := tx.GetUserByUsername(tenantID, username)
+		if err != nil {
+			return err
+		}
+		return tx.SavePreferences(user.ID, preferences.Default())
+	})
 	if err != nil {
 		log.Printf("Error saving user '%s' to the database: %v", username, err)
-		http.Error(w, "Error saving user", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Error saving user")
 		return
 	}
 
@@ -85,29 +179,36 @@ func (a *AuthService) Register(w http.ResponseWriter, r *http.Request) {
 func (a *AuthService) LoginUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		log.Printf("LoginUser error: invalid request method %s", r.Method)
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		apierror.MethodNotAllowed(w)
 		return
 	}
 
-	username := r.FormValue("username")
-	password := r.FormValue("password")
+	v, err := validation.New(r)
+	if err != nil {
+		validation.WriteBodyError(w, err)
+		return
+	}
+
+	username := v.Get("username")
+	password := v.Get("password")
 
 	log.Printf("Logging in username: %s", username)
 
-	if username == "" || password == "" {
+	v.Required("username", "password")
+	if !v.Valid() {
 		log.Printf("LoginUser error: missing username or password. Username: %s", username)
-		http.Error(w, "Missing username or password", http.StatusBadRequest)
+		v.WriteError(w, http.StatusBadRequest)
 		return
 	}
 
 	// Fetch user from database
-	user, err := a.db.GetUserByUsername(username)
+	user, err := a.db.GetUserByUsername(tenants.IDFromContext(r.Context()), username)
 	if err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid username or password")
 			log.Printf("Login failed: User not found with username '%s'", username)
 		} else {
-			http.Error(w, "Error retrieving user", http.StatusInternalServerError)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Error retrieving user")
 			log.Printf("Error retrieving user from database: %v", err)
 		}
 		return
@@ -115,11 +216,18 @@ func (a *AuthService) LoginUser(w http.ResponseWriter, r *http.Request) {
 
 	// Validate password
 	if !checkPasswordHash(password, user.HashedPassword) {
-		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid username or password")
 		log.Printf("Login failed: Invalid password for username '%s'", username)
 		return
 	}
 
+	// Checked after the password so deactivation doesn't reveal whether an account exists
+	if user.DeactivatedAt != nil {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeAccountDeactivated, "This account has been deactivated")
+		log.Printf("Login failed: username '%s' is deactivated", username)
+		return
+	}
+
 	// Generate session and CSRF tokens
 	sessionToken := generateToken(32)
 	csrfToken := generateToken(32)
@@ -131,10 +239,10 @@ func (a *AuthService) LoginUser(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_token",
 		Value:    sessionToken,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,                    // Ensures the session token cant be accessed by front-end JavaScript and only sent during HTTP requests. Reducing XSS risk.
-		Secure:   true,                    // Ensures that the cookie is only sent over HTTPS connections, preventing interception over insecure HTTP. If Secure is not set explicitly, the cookie will be sent over both HTTP and HTTPS.
-		SameSite: http.SameSiteStrictMode, // Controls whether cookies are sent with cross-site requests, mitigating CSRF risks. The default for SameSite is unset, which allows cookies to be sent with cross-origin requests.
+		Expires:  a.clock.Now().Add(24 * time.Hour),
+		HttpOnly: true,       // Ensures the session token cant be accessed by front-end JavaScript and only sent during HTTP requests. Reducing XSS risk.
+		Secure:   true,       // Ensures that the cookie is only sent over HTTPS connections, preventing interception over insecure HTTP. If Secure is not set explicitly, the cookie will be sent over both HTTP and HTTPS.
+		SameSite: a.sameSite, // Controls whether cookies are sent with cross-site requests, mitigating CSRF risks. The default for SameSite is unset, which allows cookies to be sent with cross-origin requests.
 	})
 
 	// Sets the CSRF Token
@@ -144,28 +252,34 @@ func (a *AuthService) LoginUser(w http.ResponseWriter, r *http.Request) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "csrf_token",
 		Value:    csrfToken,
-		Expires:  time.Now().Add(24 * time.Hour),
+		Expires:  a.clock.Now().Add(24 * time.Hour),
 		HttpOnly: false, // Needs to be accessible client side to be added to request headers
 		Secure:   true,
-		SameSite: http.SameSiteStrictMode,
+		SameSite: a.sameSite,
 	})
 
+	// Home the user on this instance so load balancers can route their connections here
+	if a.affinity != nil && a.affinity.Enabled() {
+		http.SetCookie(w, a.affinity.Cookie())
+	}
+
 	// Update the user's session and CSRF tokens in the database
 	err = a.db.UpdateSessionAndCSRF(user.ID, sessionToken, csrfToken)
 	if err != nil {
-		http.Error(w, "Error updating session", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Error updating session")
 		log.Printf("Error updating session: %v", err)
 		return
 	}
 
 	log.Println("Login Successful")
+	a.analytics.Track(analytics.Login, user.TenantID, user.ID, map[string]any{"method": "password"})
 	w.WriteHeader(http.StatusOK)
 }
 
 func (a *AuthService) LogoutUser(w http.ResponseWriter, r *http.Request) {
 	user, err := a.Authorise(r)
 	if err != nil {
-		http.Error(w, "Unauthorised", http.StatusUnauthorized)
+		apierror.Unauthorised(w)
 		return
 	}
 
@@ -176,22 +290,75 @@ func (a *AuthService) LogoutUser(w http.ResponseWriter, r *http.Request) {
 	// Clear session and CSRF tokens in the database
 	err = a.db.ClearSession(user.ID)
 	if err != nil {
-		http.Error(w, "Error clearing session", http.StatusInternalServerError)
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Error clearing session")
 		return
 	}
 
 	fmt.Fprintln(w, "Logged out.")
 }
 
+// DeactivateAccount lets a user deactivate their own account, after confirming their password.
+// Their session is revoked and their connections closed. Their messages stay attributed to them, and an admin can
+// reactivate the account.
+func (a *AuthService) DeactivateAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.MethodNotAllowed(w)
+		return
+	}
+
+	user, err := a.Authorise(r)
+	if err != nil {
+		apierror.Unauthorised(w)
+		return
+	}
+
+	v, err := validation.New(r)
+	if err != nil {
+		validation.WriteBodyError(w, err)
+		return
+	}
+	password := v.Get("password")
+	v.Required("password")
+	if !v.Valid() {
+		v.WriteError(w, http.StatusBadRequest)
+		return
+	}
+
+	// The session lookup doesn't load the password hash
+	account, err := a.db.GetUserByUsername(user.TenantID, user.Username)
+	if err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Error retrieving user")
+		log.Printf("Error retrieving user from database: %v", err)
+		return
+	}
+	if !checkPasswordHash(password, account.HashedPassword) {
+		apierror.Write(w, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "Invalid password")
+		return
+	}
+
+	if err := a.db.DeactivateUser(user.ID, a.clock.Now()); err != nil {
+		apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Error deactivating account")
+		log.Printf("Error deactivating user %s: %v", user.Username, err)
+		return
+	}
+	utils.CloseUserConnections(user.TenantID, user.ID, "Account deactivated")
+
+	a.setCookie(w, "session_token", "", true, true)
+	a.setCookie(w, "csrf_token", "", false, true)
+
+	log.Printf("User %s deactivated their account", user.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (a *AuthService) Profile(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		apierror.MethodNotAllowed(w)
 		return
 	}
 
 	user, err := a.Authorise(r)
 	if err != nil {
-		http.Error(w, "Unauthorised", http.StatusUnauthorized)
+		apierror.Unauthorised(w)
 		log.Printf("Error authorizing session: %v", err)
 		return
 	}
@@ -252,6 +419,12 @@ func (a *AuthService) Authorise(r *http.Request) (*models.User, error) {
 		return nil, errors.New("unauthorised")
 	}
 
+	// Session tokens are only valid for the tenant they were issued by
+	if user.TenantID != tenants.IDFromContext(r.Context()) {
+		log.Printf("Authorization failed: session for user %s belongs to a different tenant", user.Username)
+		return nil, errors.New("unauthorised")
+	}
+
 	if user.CSRFToken != csrfToken {
 		log.Printf("Authorization failed: CSRF token mismatch for user %s. Expected: %s, Received: %s",
 			user.Username, user.CSRFToken, csrfToken)
@@ -262,21 +435,38 @@ func (a *AuthService) Authorise(r *http.Request) (*models.User, error) {
 	return &user, nil
 }
 
+// AuthoriseAdmin authorises the request like Authorise and also requires the user to be an admin.
+func (a *AuthService) AuthoriseAdmin(r *http.Request) (*models.User, error) {
+	user, err := a.Authorise(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.IsAdmin {
+		log.Printf("Admin authorization failed: user %s is not an admin", user.Username)
+		return nil, ErrNotAdmin
+	}
+	return user, nil
+}
+
 // SessionCheck checks if the user has valid session tokens
 func (a *AuthService) SessionCheck(w http.ResponseWriter, r *http.Request) {
 	// Get session token
 	sessionCookie, err := r.Cookie("session_token")
 	if err != nil || sessionCookie.Value == "" {
 		log.Printf("Session check failed: Missing session token. Error: %v", err)
-		http.Error(w, "Unauthorised", http.StatusUnauthorized)
+		apierror.Unauthorised(w)
 		return
 	}
 
 	// Validate session token
 	user, err := a.db.GetUserBySessionToken(sessionCookie.Value)
+	if err == nil && user.TenantID != tenants.IDFromContext(r.Context()) {
+		err = errors.New("session belongs to a different tenant")
+	}
 	if err != nil {
 		log.Printf("Session check failed: Invalid session token. Error: %v", err)
-		http.Error(w, "Unauthorised", http.StatusUnauthorized)
+		apierror.Unauthorised(w)
 		return
 	}
 
@@ -296,9 +486,9 @@ func (a *AuthService) setCookie(w http.ResponseWriter, name, value string, httpO
 	http.SetCookie(w, &http.Cookie{
 		Name:     name,
 		Value:    value,
-		Expires:  time.Now().Add(24 * time.Hour),
+		Expires:  a.clock.Now().Add(24 * time.Hour),
 		HttpOnly: httpOnly,
 		Secure:   secure,
-		SameSite: http.SameSiteStrictMode,
+		SameSite: a.sameSite,
 	})
 }
@@ -1,13 +1,21 @@
 package auth_test
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
+	"go-chat-app/apierror"
 	"go-chat-app/auth"
+	"go-chat-app/clock"
 	"go-chat-app/db"
+	"go-chat-app/models"
+	"go-chat-app/tenants"
+	"go-chat-app/validation"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -34,6 +42,22 @@ func TestRegister_Success(t *testing.T) {
 	}
 }
 
+func TestRegister_SavesDefaultPreferences(t *testing.T) {
+	service, mockDB := setupAuthService()
+
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader("username=user1&password=securepassword"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	service.Register(httptest.NewRecorder(), req)
+
+	user, err := mockDB.GetUserByUsername(1, "user1")
+	if err != nil {
+		t.Fatalf("user not saved: %v", err)
+	}
+	if _, ok, _ := mockDB.GetPreferences(user.ID); !ok {
+		t.Error("expected default preferences to be saved with the user")
+	}
+}
+
 func TestRegister_InvalidInput(t *testing.T) {
 	service, _ := setupAuthService()
 
@@ -51,7 +75,7 @@ func TestRegister_InvalidInput(t *testing.T) {
 
 func TestRegister_UsernameConflict(t *testing.T) {
 	service, mockDB := setupAuthService()
-	mockDB.SaveUser("user1", "hashedpassword")
+	mockDB.SaveUser(1, "user1", "hashedpassword")
 
 	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader("username=user1&password=securepassword"))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -71,7 +95,7 @@ func TestLoginUser_Success(t *testing.T) {
 	password := "securepassword"
 	hashedPasswordBytes, _ := bcrypt.GenerateFromPassword([]byte(password), 10)
 	hashedPassword := string(hashedPasswordBytes)
-	mockDB.SaveUser("user1", hashedPassword)
+	mockDB.SaveUser(1, "user1", hashedPassword)
 
 	mockDB.UpdateSessionAndCSRF(1, "session123", "csrf123")
 
@@ -92,6 +116,27 @@ func TestLoginUser_Success(t *testing.T) {
 	}
 }
 
+func TestLoginUser_CookiesExpireADayFromLogin(t *testing.T) {
+	mockDB := db.NewMockDB()
+	loginAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	service := auth.NewAuthService(mockDB, auth.WithClock(clock.NewFake(loginAt)))
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("securepassword"), 10)
+	mockDB.SaveUser(1, "user1", string(hashedPassword))
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=user1&password=securepassword"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	service.LoginUser(w, req)
+
+	want := loginAt.Add(24 * time.Hour)
+	for _, cookie := range w.Result().Cookies() {
+		if !cookie.Expires.Equal(want) {
+			t.Errorf("cookie %s expires %v, want %v", cookie.Name, cookie.Expires, want)
+		}
+	}
+}
+
 func TestLoginUser_InvalidCredentials(t *testing.T) {
 	service, _ := setupAuthService()
 
@@ -109,7 +154,7 @@ func TestLoginUser_InvalidCredentials(t *testing.T) {
 
 func TestLogoutUser_Success(t *testing.T) {
 	service, mockDB := setupAuthService()
-	mockDB.SaveUser("user1", "hashedpassword")
+	mockDB.SaveUser(1, "user1", "hashedpassword")
 	mockDB.UpdateSessionAndCSRF(1, "session123", "csrf123")
 
 	req := httptest.NewRequest(http.MethodPost, "/logout", nil)
@@ -148,7 +193,7 @@ func TestLogoutUser_Unauthorised(t *testing.T) {
 
 func TestProfile_Success(t *testing.T) {
 	service, mockDB := setupAuthService()
-	mockDB.SaveUser("user1", "hashedpassword")
+	mockDB.SaveUser(1, "user1", "hashedpassword")
 	mockDB.UpdateSessionAndCSRF(1, "session123", "csrf123")
 
 	req := httptest.NewRequest(http.MethodPost, "/profile", nil)
@@ -181,7 +226,7 @@ func TestProfile_Unauthorised(t *testing.T) {
 func TestSessionCheck_Success(t *testing.T) {
 	service, mockDB := setupAuthService()
 
-	mockDB.SaveUser("user1", "hashedpassword")
+	mockDB.SaveUser(1, "user1", "hashedpassword")
 	mockDB.UpdateSessionAndCSRF(1, "valid-session-token", "valid-csrf-token")
 
 	req := httptest.NewRequest(http.MethodGet, "/session-check", nil)
@@ -206,7 +251,7 @@ func TestSessionCheck_Success(t *testing.T) {
 func TestSessionCheck_InvalidSessionToken(t *testing.T) {
 	service, mockDB := setupAuthService()
 
-	mockDB.SaveUser("user1", "hashedpassword")
+	mockDB.SaveUser(1, "user1", "hashedpassword")
 
 	req := httptest.NewRequest(http.MethodGet, "/session-check", nil)
 	req.AddCookie(&http.Cookie{Name: "session_token", Value: "invalid-session-token"})
@@ -220,3 +265,205 @@ func TestSessionCheck_InvalidSessionToken(t *testing.T) {
 		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
 	}
 }
+
+func TestLoginUser_SameSiteNone(t *testing.T) {
+	mockDB := db.NewMockDB()
+	service := auth.NewAuthService(mockDB, auth.WithSameSite(http.SameSiteNoneMode))
+
+	hashedPasswordBytes, _ := bcrypt.GenerateFromPassword([]byte("securepassword"), 10)
+	mockDB.SaveUser(1, "user1", string(hashedPasswordBytes))
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=user1&password=securepassword"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	service.LoginUser(w, req)
+
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.SameSite != http.SameSiteNoneMode {
+			t.Errorf("expected cookie %s to have SameSite=None, got %v", cookie.Name, cookie.SameSite)
+		}
+		if !cookie.Secure {
+			t.Errorf("expected cookie %s to be Secure", cookie.Name)
+		}
+	}
+}
+
+func TestProfile_OtherTenantSession(t *testing.T) {
+	service, mockDB := setupAuthService()
+	mockDB.SaveUser(2, "user1", "hashedpassword")
+	mockDB.UpdateSessionAndCSRF(1, "session123", "csrf123")
+
+	// Session belongs to tenant 2 but the request resolved to the default tenant
+	req := httptest.NewRequest(http.MethodPost, "/profile", nil)
+	req = req.WithContext(tenants.NewContext(req.Context(), models.Tenant{ID: tenants.DefaultTenantID}))
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: "session123"})
+	req.Header.Set("X-CSRF-Token", "csrf123")
+	w := httptest.NewRecorder()
+
+	service.Profile(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+}
+
+func TestLoginUser_ErrorEnvelope(t *testing.T) {
+	service, _ := setupAuthService()
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=user1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	service.LoginUser(w, req)
+
+	var body apierror.Response
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("expected JSON error body, got error: %v", err)
+	}
+	if body.Code != apierror.CodeValidationFailed || body.Message == "" {
+		t.Errorf("expected code %s with a message, got %+v", apierror.CodeValidationFailed, body)
+	}
+}
+
+func TestRegister_JSONBody(t *testing.T) {
+	service, mockDB := setupAuthService()
+
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"username": "user1", "password": "securepassword"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	service.Register(w, req)
+
+	if w.Result().StatusCode != http.StatusCreated {
+		t.Errorf("expected status %d, got %d", http.StatusCreated, w.Result().StatusCode)
+	}
+	if _, err := mockDB.GetUserByUsername(1, "user1"); err != nil {
+		t.Errorf("expected user to be saved: %v", err)
+	}
+}
+
+func TestRegister_FieldErrors(t *testing.T) {
+	service, _ := setupAuthService()
+
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader("username=bad%20name&password=short"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	service.Register(w, req)
+
+	var body struct {
+		Code    apierror.Code           `json:"code"`
+		Details []validation.FieldError `json:"details"`
+	}
+	json.NewDecoder(w.Body).Decode(&body)
+
+	if body.Code != apierror.CodeValidationFailed {
+		t.Errorf("expected code %s, got %s", apierror.CodeValidationFailed, body.Code)
+	}
+	if len(body.Details) != 2 || body.Details[0].Field != "username" || body.Details[1].Field != "password" {
+		t.Errorf("expected username and password field errors, got %+v", body.Details)
+	}
+}
+
+func TestRegister_CaseInsensitiveConflict(t *testing.T) {
+	service, mockDB := setupAuthService()
+	mockDB.SaveUser(1, "User1", "hashedpassword")
+
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader("username=user1&password=securepassword"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	service.Register(w, req)
+
+	if w.Result().StatusCode != http.StatusConflict {
+		t.Errorf("expected status %d, got %d", http.StatusConflict, w.Result().StatusCode)
+	}
+}
+
+func TestRegister_ReservedUsername(t *testing.T) {
+	service, _ := setupAuthService()
+
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader("username=System&password=securepassword"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	service.Register(w, req)
+
+	if w.Result().StatusCode != http.StatusNotAcceptable {
+		t.Errorf("expected status %d, got %d", http.StatusNotAcceptable, w.Result().StatusCode)
+	}
+}
+
+func TestAuthoriseAdmin(t *testing.T) {
+	service, mockDB := setupAuthService()
+	mockDB.SaveUser(1, "user1", "hashedpassword")
+	mockDB.UpdateSessionAndCSRF(1, "session123", "csrf123")
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/admin/connections", nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: "session123"})
+		req.Header.Set("X-CSRF-Token", "csrf123")
+		return req
+	}
+
+	if _, err := service.AuthoriseAdmin(newRequest()); !errors.Is(err, auth.ErrNotAdmin) {
+		t.Errorf("expected ErrNotAdmin for a regular user, got %v", err)
+	}
+
+	mockDB.SetAdmin(1, true)
+	if _, err := service.AuthoriseAdmin(newRequest()); err != nil {
+		t.Errorf("expected admin to be authorised, got %v", err)
+	}
+}
+
+func TestDeactivateAccount(t *testing.T) {
+	service, mockDB := setupAuthService()
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("securepassword"), 10)
+	mockDB.SaveUser(1, "user1", string(hashedPassword))
+	mockDB.UpdateSessionAndCSRF(1, "session123", "csrf123")
+
+	deactivate := func(password string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, "/account/deactivate", strings.NewReader("password="+password))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: "session123"})
+		req.Header.Set("X-CSRF-Token", "csrf123")
+		w := httptest.NewRecorder()
+		service.DeactivateAccount(w, req)
+		return w.Result()
+	}
+
+	if resp := deactivate("wrongpassword"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected status %d for a wrong password, got %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+	if resp := deactivate("securepassword"); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, resp.StatusCode)
+	}
+
+	// The session is revoked
+	if _, err := mockDB.GetUserBySessionToken("session123"); err == nil {
+		t.Error("expected the session to be revoked")
+	}
+
+	login := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("username=user1&password=securepassword"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		service.LoginUser(w, req)
+		return w
+	}
+
+	w := login()
+	var body apierror.Response
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusForbidden || body.Code != apierror.CodeAccountDeactivated {
+		t.Errorf("expected status %d with code %s, got %d %+v", http.StatusForbidden, apierror.CodeAccountDeactivated, w.Code, body)
+	}
+
+	// Reactivation restores access
+	mockDB.ReactivateUser(1)
+	if w := login(); w.Code != http.StatusOK {
+		t.Errorf("expected status %d after reactivation, got %d", http.StatusOK, w.Code)
+	}
+}
@@ -0,0 +1,87 @@
+package backoff
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Reconnect guidance for clients. When the server closes a connection or turns one away, it tells the client how long
+// to wait before reconnecting, plus a jitter window to spread its retry over. The wait grows with the load on the
+// instance, so after a deploy or an outage thousands of clients don't all reconnect in the same second.
+//
+// Closed connections carry the guidance as JSON in the WebSocket close reason:
+//
+//	{"reason":"Closed by an admin","retryAfterMs":2000,"jitterMs":2000}
+//
+// and rejected HTTP requests carry it in the Retry-After header, rounded up to whole seconds.
+
+// Bounds on the recommended wait
+const (
+	minRetryAfter = time.Second
+	maxRetryAfter = 60 * time.Second
+)
+
+// maxCloseReason is the most a WebSocket close reason can hold, as control frames are limited to 125 bytes
+const maxCloseReason = 123
+
+// Config is the connection capacity that load is measured against.
+type Config struct {
+	MaxConnections int // 0 if unlimited, in which case the minimum wait is always recommended
+}
+
+// LoadConfig reads WS_MAX_CONNECTIONS, the most WebSocket connections an instance accepts.
+func LoadConfig() Config {
+	max, err := strconv.Atoi(os.Getenv("WS_MAX_CONNECTIONS"))
+	if err != nil || max < 0 {
+		max = 0
+	}
+	return Config{MaxConnections: max}
+}
+
+// Full reports whether the instance is at capacity and should turn new connections away.
+func (c Config) Full(connections int) bool {
+	return c.MaxConnections > 0 && connections >= c.MaxConnections
+}
+
+// Advice is how long a client should wait before reconnecting.
+type Advice struct {
+	RetryAfter time.Duration // Wait at least this long
+	Jitter     time.Duration // Then add a random delay of up to this long
+}
+
+// Recommend works out the wait for the current number of connections. It grows quadratically with load, so lightly
+// loaded instances get clients back quickly and those near capacity spread them out.
+func (c Config) Recommend(connections int) Advice {
+	retryAfter := minRetryAfter
+	if c.MaxConnections > 0 {
+		load := math.Min(float64(connections)/float64(c.MaxConnections), 1)
+		retryAfter += time.Duration(load * load * float64(maxRetryAfter-minRetryAfter))
+	}
+	return Advice{RetryAfter: retryAfter, Jitter: retryAfter}
+}
+
+// Seconds returns the wait in whole seconds for a Retry-After header.
+func (a Advice) Seconds() string {
+	return strconv.Itoa(int(math.Ceil(a.RetryAfter.Seconds())))
+}
+
+// CloseReason encodes a close reason with the advice, truncating the reason to fit in a close frame.
+func (a Advice) CloseReason(reason string) string {
+	payload := struct {
+		Reason       string `json:"reason"`
+		RetryAfterMs int64  `json:"retryAfterMs"`
+		JitterMs     int64  `json:"jitterMs"`
+	}{reason, a.RetryAfter.Milliseconds(), a.Jitter.Milliseconds()}
+
+	for {
+		encoded, _ := json.Marshal(payload)
+		if len(encoded) <= maxCloseReason || payload.Reason == "" {
+			return string(encoded)
+		}
+		runes := []rune(payload.Reason)
+		payload.Reason = string(runes[:len(runes)-1])
+	}
+}
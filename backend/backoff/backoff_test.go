@@ -0,0 +1,79 @@
+package backoff
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecommend(t *testing.T) {
+	config := Config{MaxConnections: 100}
+
+	tests := []struct {
+		name        string
+		connections int
+		want        time.Duration
+	}{
+		{"idle", 0, time.Second},
+		{"half loaded", 50, time.Second + 59*time.Second/4},
+		{"full", 100, 60 * time.Second},
+		{"over capacity", 250, 60 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			advice := config.Recommend(tt.connections)
+			if advice.RetryAfter != tt.want {
+				t.Errorf("RetryAfter = %v, want %v", advice.RetryAfter, tt.want)
+			}
+			if advice.Jitter != advice.RetryAfter {
+				t.Errorf("Jitter = %v, want %v", advice.Jitter, advice.RetryAfter)
+			}
+		})
+	}
+
+	if got := (Config{}).Recommend(1_000_000).RetryAfter; got != time.Second {
+		t.Errorf("unlimited RetryAfter = %v, want 1s", got)
+	}
+}
+
+func TestFull(t *testing.T) {
+	if (Config{}).Full(1_000_000) {
+		t.Error("unlimited config reported full")
+	}
+	config := Config{MaxConnections: 10}
+	if config.Full(9) || !config.Full(10) {
+		t.Error("Full should be true at and only at capacity")
+	}
+}
+
+func TestSeconds(t *testing.T) {
+	if got := (Advice{RetryAfter: 1500 * time.Millisecond}).Seconds(); got != "2" {
+		t.Errorf("Seconds() = %q, want rounded up to 2", got)
+	}
+}
+
+func TestCloseReason(t *testing.T) {
+	advice := Advice{RetryAfter: 2 * time.Second, Jitter: 2 * time.Second}
+
+	var payload struct {
+		Reason       string `json:"reason"`
+		RetryAfterMs int64  `json:"retryAfterMs"`
+		JitterMs     int64  `json:"jitterMs"`
+	}
+	if err := json.Unmarshal([]byte(advice.CloseReason("Closed by an admin")), &payload); err != nil {
+		t.Fatalf("close reason isn't JSON: %v", err)
+	}
+	if payload.Reason != "Closed by an admin" || payload.RetryAfterMs != 2000 || payload.JitterMs != 2000 {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+
+	// Long reasons are truncated to fit in a close frame
+	long := advice.CloseReason(strings.Repeat("é", 100))
+	if len(long) > maxCloseReason {
+		t.Errorf("close reason is %d bytes, want at most %d", len(long), maxCloseReason)
+	}
+	if err := json.Unmarshal([]byte(long), &payload); err != nil {
+		t.Errorf("truncated close reason isn't JSON: %v", err)
+	}
+}
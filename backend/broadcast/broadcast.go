@@ -1,79 +1,253 @@
 package broadcast
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 
 	"go-chat-app/db"
+	"go-chat-app/featureflags"
+	"go-chat-app/frames"
 	"go-chat-app/models"
+	"go-chat-app/protocol"
+	"go-chat-app/tracing"
 	"go-chat-app/utils"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
-var dbInstance db.DBInterface
+var (
+	dbInstance  db.DBInterface
+	broadcaster Broadcaster         = LocalBroadcaster{}
+	flags       *featureflags.Flags // Nil uses each flag's built in default
+)
 
 // InitBroadcast initialises injected dependencies for use by broadcast listers
-func InitBroadcast(db db.DBInterface) {
+func InitBroadcast(db db.DBInterface, b Broadcaster, f *featureflags.Flags) {
 	dbInstance = db
+	broadcaster = b
+	flags = f
 }
 
 // StartBroadcastListener listens for chat messages on the broadcast channel and sends them to all connected clients.
 func StartBroadcastListener() {
 	broadcast := utils.GetBroadcastChannel()
-	clients, mutex := utils.GetClients()
 
-	for msg := range broadcast {
-		messageBytes, _ := json.Marshal(msg)
-		mutex.Lock()
+	for outbound := range broadcast {
+		deliver(outbound)
+	}
+}
+
+// deliver fans out one outbound message or frame. A panic only loses that message, so the listener keeps running.
+func deliver(outbound models.OutboundMessage) {
+	defer utils.Recover("hub fan-out")
 
-		for client := range clients {
-			select {
-			case client.Send <- messageBytes:
-			default:
-				// Remove client if unresponsive
-				utils.DeregisterClient(client)
+	_, span := tracing.Tracer().Start(outbound.Ctx, "hub.fanout")
+	defer span.End()
+	var recipients int
+	if outbound.Frame != nil {
+		recipients = fanOutFrame(*outbound.Frame)
+	} else {
+		recipients = fanOut(outbound.Message)
+	}
+	span.SetAttributes(attribute.Int("chat.recipients", recipients))
+}
+
+// fanOutFrame sends a frame to every client in its tenant that agreed to the frame's type.
+// Frames for features behind a feature flag only go to users the flag is on for.
+func fanOutFrame(tenantFrame models.TenantFrame) int {
+	frame, err := frames.Marshal(json.RawMessage(tenantFrame.Payload))
+	if err != nil {
+		log.Printf("Failed to encode %s frame: %v", tenantFrame.Type, err)
+		return 0
+	}
+	defer frame.Release()
+
+	// The flag is looked up before locking any shards, as it may need loading from the database
+	flagName, gated := featureflags.FrameFlag(tenantFrame.Type)
+	var flag models.FeatureFlag
+	if gated {
+		flag = flags.Get(tenantFrame.TenantID, flagName)
+	}
+
+	recipients := 0
+	var unresponsive []*models.Client
+	utils.ForEachClient(func(client *models.Client) {
+		if client.TenantID != tenantFrame.TenantID || !client.Capabilities().Supports(tenantFrame.Type) {
+			return
+		}
+		if gated && !featureflags.Evaluate(flag, client.UserID) {
+			return
+		}
+		if frame.TrySend(client.Send) {
+			recipients++
+		} else {
+			unresponsive = append(unresponsive, client)
+		}
+	})
+
+	for _, client := range unresponsive {
+		utils.DeregisterClient(client)
+	}
+	return recipients
+}
+
+// fanOut sends a message to every client in the sender's tenant and returns how many it was sent to.
+// The message is encoded once and the same frame is queued for every recipient.
+func fanOut(msg models.Message) int {
+	frame, err := frames.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to encode message: %v", err)
+		return 0
+	}
+	defer frame.Release()
+
+	countMessage(msg.TenantID)
+
+	// Clients that didn't agree to the message's type get it as a plain chat message, encoded only if needed
+	var plainFrame *frames.Frame
+	defer func() {
+		if plainFrame != nil {
+			plainFrame.Release()
+		}
+	}()
+
+	recipients := 0
+	var unresponsive []*models.Client
+	utils.ForEachClient(func(client *models.Client) {
+		// Tenants are isolated so only deliver to clients of the sender's tenant
+		if client.TenantID != msg.TenantID {
+			return
+		}
+
+		f := frame
+		if msg.Type != "" && !client.Capabilities().Supports(msg.Type) {
+			if plainFrame == nil {
+				plainFrame, _ = frames.Marshal(msg.PlainText())
 			}
+			f = plainFrame
 		}
-		mutex.Unlock()
+		if f == nil {
+			return
+		}
+
+		if f.TrySend(client.Send) {
+			recipients++
+		} else {
+			unresponsive = append(unresponsive, client)
+		}
+	})
+
+	// Remove unresponsive clients
+	for _, client := range unresponsive {
+		utils.DeregisterClient(client)
 	}
+	return recipients
 }
 
 // StartNotifyActiveUsers listens for updates and notifies all clients of the current active user list.
 func StartNotifyActiveUsers() {
 	notifyClients := utils.GetNotifyClientsChannel()
-	clients, mutex := utils.GetClients()
 
 	for range notifyClients {
-		activeUsers := utils.CollectActiveUsers()
+		notifyActiveUsers()
+	}
+}
+
+// notifyActiveUsers sends every client its tenant's active user list. A panic only skips this update.
+func notifyActiveUsers() {
+	defer utils.Recover("active users notification")
 
+	activeUsers := utils.CollectActiveUsers()
+
+	// Each tenant only sees its own active users
+	messages := make(map[int]*frames.Frame)
+	for tenantID, users := range activeUsers {
 		msg := models.ActiveUsersMessage{
 			Type:  "activeUsers",
-			Users: activeUsers,
+			Users: users,
+		}
+		if frame, err := frames.Marshal(msg); err == nil {
+			messages[tenantID] = frame
 		}
+	}
 
-		messageBytes, _ := json.Marshal(msg)
+	var unresponsive []*models.Client
+	utils.ForEachClient(func(client *models.Client) {
+		frame := messages[client.TenantID]
+		if frame == nil || !client.Capabilities().Supports(protocol.TypeActiveUsers) {
+			return
+		}
+		if !frame.TrySend(client.Send) {
+			unresponsive = append(unresponsive, client)
+		}
+	})
+	for _, frame := range messages {
+		frame.Release()
+	}
 
-		mutex.Lock()
-		for client := range clients {
-			select {
-			case client.Send <- messageBytes:
-			default:
-				// Remove unresponsive client
+	// Remove unresponsive clients. Done in a goroutine as deregistering notifies this loop again
+	if len(unresponsive) > 0 {
+		go func() {
+			for _, client := range unresponsive {
 				utils.DeregisterClient(client)
 			}
-		}
-		mutex.Unlock()
+		}()
 	}
 }
 
+// BroadcastFrame sends a frame to every client in a tenant that supports the frame's type, across all instances.
+func BroadcastFrame(ctx context.Context, tenantID int, frameType string, v any) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to encode %s frame: %v", frameType, err)
+		return
+	}
+
+	frame := models.TenantFrame{TenantID: tenantID, Type: frameType, Payload: payload}
+	if err := broadcaster.PublishFrame(ctx, frame); err != nil {
+		log.Printf("Failed to broadcast %s frame: %v", frameType, err)
+	}
+}
+
+// ToggleReaction adds or removes a user's reaction to a message and tells the tenant's clients about the change.
+func ToggleReaction(ctx context.Context, tenantID, userID int, username string, messageID int, emoji string) error {
+	_, span := tracing.Tracer().Start(ctx, "reaction.persist")
+	added, count, err := dbInstance.ToggleReaction(tenantID, messageID, userID, emoji)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to toggle reaction")
+		span.End()
+		return err
+	}
+	span.End()
+
+	BroadcastFrame(ctx, tenantID, protocol.TypeReaction, models.ReactionUpdate{
+		Type:      protocol.TypeReaction,
+		MessageID: messageID,
+		Emoji:     emoji,
+		User:      username,
+		Added:     added,
+		Count:     count,
+	})
+	return nil
+}
+
 // BroadcastMessage sends a message to the broadcast channel when a user sends a chat message.
-func BroadcastMessage(msg models.Message) {
+// The message's ID must already be assigned, so it is delivered with the same ID even if saving it fails.
+func BroadcastMessage(ctx context.Context, msg models.Message) {
 	// Save to database
-	err := dbInstance.SaveMessage(msg)
-	if err != nil {
+	_, span := tracing.Tracer().Start(ctx, "message.persist")
+	if _, err := dbInstance.SaveMessage(msg); err != nil {
 		log.Printf("Failed to save message to DB: %v", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "failed to save message")
 	}
+	span.End()
 
 	// Broadcast to all connected clients
-	broadcast := utils.GetBroadcastChannel()
-	broadcast <- msg
+	if err := broadcaster.Publish(ctx, msg); err != nil {
+		log.Printf("Failed to broadcast message: %v", err)
+	}
 }
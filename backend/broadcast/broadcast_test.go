@@ -0,0 +1,150 @@
+package broadcast
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-chat-app/frames"
+	"go-chat-app/models"
+	"go-chat-app/protocol"
+	"go-chat-app/utils"
+)
+
+func init() {
+	// Nothing listens for active user updates in tests
+	go func() {
+		for range utils.GetNotifyClientsChannel() {
+		}
+	}()
+}
+
+// registerTestClients registers clients with buffered send queues, deregistering them when the test ends.
+func registerTestClients(tb testing.TB, n, tenantID int) []*models.Client {
+	clients := make([]*models.Client, n)
+	for i := range clients {
+		clients[i] = &models.Client{
+			ID:       tb.Name() + "-" + strconv.Itoa(tenantID) + "-" + strconv.Itoa(i),
+			TenantID: tenantID,
+			Send:     make(chan *frames.Frame, 1),
+		}
+		clients[i].SetCapabilities(protocol.LegacyCapabilities())
+		utils.RegisterClient(clients[i])
+	}
+	tb.Cleanup(func() {
+		for _, client := range clients {
+			utils.DeregisterClient(client)
+		}
+	})
+	return clients
+}
+
+// receive takes the frame queued for a client, releasing it.
+func receive(t *testing.T, client *models.Client) string {
+	select {
+	case frame := <-client.Send:
+		defer frame.Release()
+		return string(frame.Bytes())
+	default:
+		t.Fatalf("expected a frame for client %s", client.ID)
+		return ""
+	}
+}
+
+func TestFanOut_SharesFrameWithinTenant(t *testing.T) {
+	tenantOne := registerTestClients(t, 2, 1)
+	tenantTwo := registerTestClients(t, 1, 2)
+
+	recipients := fanOut(models.Message{TenantID: 1, Sender: "user1", Content: "hello", Timestamp: time.Unix(0, 0).UTC()})
+	if recipients != 2 {
+		t.Fatalf("expected 2 recipients, got %d", recipients)
+	}
+
+	want := `{"sender":"user1","content":"hello","timestamp":"1970-01-01T00:00:00Z"}`
+	for _, client := range tenantOne {
+		if got := receive(t, client); got != want {
+			t.Errorf("expected %s, got %s", want, got)
+		}
+	}
+	if len(tenantTwo[0].Send) != 0 {
+		t.Error("expected no frame for a client in another tenant")
+	}
+}
+
+func TestFanOut_FallsBackToPlainText(t *testing.T) {
+	clients := registerTestClients(t, 2, 3)
+	clients[1].SetCapabilities(protocol.Negotiate(protocol.Hello{MessageTypes: []string{protocol.TypeChat, protocol.TypeCode}}))
+
+	fanOut(models.Message{TenantID: 3, Type: protocol.TypeCode, Sender: "user1", Language: "go", Content: "x := 1", Highlighted: "<pre>x := 1</pre>"})
+
+	if got := receive(t, clients[0]); got == "" || strings.Contains(got, "highlighted") {
+		t.Errorf("expected a plain chat message for a legacy client, got %s", got)
+	}
+	if got := receive(t, clients[1]); !strings.Contains(got, `"highlighted":"<pre>x := 1</pre>"`) {
+		t.Errorf("expected a code message, got %s", got)
+	}
+}
+
+func TestFanOutFrame_OnlySupportingClients(t *testing.T) {
+	clients := registerTestClients(t, 2, 4)
+	clients[1].SetCapabilities(protocol.Negotiate(protocol.Hello{MessageTypes: []string{protocol.TypeChat, protocol.TypeReaction}}))
+
+	payload := `{"type":"reaction","messageId":1,"emoji":"👍","user":"user1","added":true,"count":1}`
+	recipients := fanOutFrame(models.TenantFrame{TenantID: 4, Type: protocol.TypeReaction, Payload: []byte(payload)})
+	if recipients != 1 {
+		t.Fatalf("expected 1 recipient, got %d", recipients)
+	}
+
+	if len(clients[0].Send) != 0 {
+		t.Error("expected no frame for a legacy client")
+	}
+	if got := receive(t, clients[1]); got != payload {
+		t.Errorf("expected %s, got %s", payload, got)
+	}
+}
+
+// BenchmarkFanOut measures encoding and queueing one message for 1,000 clients.
+// Run with: go test ./broadcast -bench FanOut -benchmem
+func BenchmarkFanOut(b *testing.B) {
+	clients := registerTestClients(b, 1000, 100)
+	msg := models.Message{TenantID: 100, Sender: "user1", Content: "hello everyone", Timestamp: time.Now()}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		fanOut(msg)
+
+		// Stand in for the client writers
+		for _, client := range clients {
+			(<-client.Send).Release()
+		}
+	}
+}
+
+func TestPublishStats_OnlyAdminsThatAgreed(t *testing.T) {
+	clients := registerTestClients(t, 3, 5)
+	admin, legacyAdmin, member := clients[0], clients[1], clients[2]
+	admin.IsAdmin, legacyAdmin.IsAdmin = true, true
+	withStats := protocol.Negotiate(protocol.Hello{MessageTypes: []string{protocol.TypeChat, protocol.TypeStats}})
+	admin.SetCapabilities(withStats)
+	member.SetCapabilities(withStats)
+
+	takeMessageCounts()
+	countMessage(5)
+	countMessage(5)
+	publishStats(time.Unix(0, 0).UTC(), 2*time.Second)
+
+	got := receive(t, admin)
+	for _, want := range []string{`"type":"stats"`, `"connections":3`, `"connectedUsers":3`, `"messagesPerSecond":1`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected stats frame to contain %s, got %s", want, got)
+		}
+	}
+	if len(legacyAdmin.Send) != 0 {
+		t.Error("expected no stats for an admin that didn't agree to them")
+	}
+	if len(member.Send) != 0 {
+		t.Error("expected no stats for a non-admin")
+	}
+}
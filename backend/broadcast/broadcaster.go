@@ -0,0 +1,52 @@
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go-chat-app/models"
+	"go-chat-app/utils"
+)
+
+// Broadcaster distributes persisted chat messages to the broadcast listener of every instance.
+// The local broadcaster only reaches clients connected to this instance, which is all a single instance deployment
+// needs. Deployments running several instances behind a load balancer use a pub/sub backed broadcaster instead so
+// clients connected to different instances still see each other's messages.
+type Broadcaster interface {
+	Publish(ctx context.Context, msg models.Message) error
+	PublishFrame(ctx context.Context, frame models.TenantFrame) error
+	Close() error
+}
+
+// NewBroadcasterFromEnv creates the broadcaster selected by BROADCASTER ("local" or "nats").
+func NewBroadcasterFromEnv() (Broadcaster, error) {
+	switch os.Getenv("BROADCASTER") {
+	case "", "local":
+		return LocalBroadcaster{}, nil
+	case "nats":
+		return NewNATSBroadcaster(os.Getenv("NATS_URL"))
+	default:
+		return nil, fmt.Errorf("unknown broadcaster %q", os.Getenv("BROADCASTER"))
+	}
+}
+
+// LocalBroadcaster hands messages straight to this instance's broadcast listener.
+type LocalBroadcaster struct{}
+
+// Publish queues a message for fan-out to this instance's clients.
+func (LocalBroadcaster) Publish(ctx context.Context, msg models.Message) error {
+	utils.GetBroadcastChannel() <- models.OutboundMessage{Ctx: ctx, Message: msg}
+	return nil
+}
+
+// PublishFrame queues a frame for fan-out to this instance's clients.
+func (LocalBroadcaster) PublishFrame(ctx context.Context, frame models.TenantFrame) error {
+	utils.GetBroadcastChannel() <- models.OutboundMessage{Ctx: ctx, Frame: &frame}
+	return nil
+}
+
+// Close does nothing for the local broadcaster.
+func (LocalBroadcaster) Close() error {
+	return nil
+}
@@ -0,0 +1,130 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-chat-app/models"
+	"go-chat-app/utils"
+
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Each tenant's messages are published on their own subject, e.g. "chat.tenant.1", and every instance subscribes
+// to all of them, passing received messages to its local broadcast listener.
+const (
+	natsSubjectPrefix = "chat.tenant."
+	natsSubscription  = natsSubjectPrefix + "*"
+
+	natsFrameTypeHeader = "Chat-Frame-Type" // Set on frames other than chat messages
+)
+
+// NATSBroadcaster publishes messages over NATS so they reach clients on every instance.
+type NATSBroadcaster struct {
+	conn *nats.Conn
+	sub  *nats.Subscription
+}
+
+// NewNATSBroadcaster connects to NATS and subscribes to messages from all instances.
+// The connection retries forever, and nats.go re-establishes the subscription after reconnecting.
+func NewNATSBroadcaster(url string) (*NATSBroadcaster, error) {
+	if url == "" {
+		url = nats.DefaultURL
+	}
+
+	conn, err := nats.Connect(url,
+		nats.Name("go-chat-app"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2*time.Second),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.Printf("Disconnected from NATS: %v", err)
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			log.Printf("Reconnected to NATS at %s", conn.ConnectedUrl())
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	b := &NATSBroadcaster{conn: conn}
+	b.sub, err = conn.Subscribe(natsSubscription, b.receive)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", natsSubscription, err)
+	}
+
+	log.Printf("Broadcasting messages over NATS at %s", url)
+	return b, nil
+}
+
+// Publish sends a message to every instance, including this one.
+func (b *NATSBroadcaster) Publish(ctx context.Context, msg models.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	// Carry the trace context in the NATS headers so fan-out on other instances joins the same trace
+	natsMsg := nats.NewMsg(natsSubjectPrefix + strconv.Itoa(msg.TenantID))
+	natsMsg.Data = data
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(natsMsg.Header))
+
+	if err := b.conn.PublishMsg(natsMsg); err != nil {
+		return fmt.Errorf("failed to publish message: %w", err)
+	}
+	return nil
+}
+
+// PublishFrame sends a frame to every instance, including this one. The frame type is carried in a header.
+func (b *NATSBroadcaster) PublishFrame(ctx context.Context, frame models.TenantFrame) error {
+	natsMsg := nats.NewMsg(natsSubjectPrefix + strconv.Itoa(frame.TenantID))
+	natsMsg.Data = frame.Payload
+	natsMsg.Header.Set(natsFrameTypeHeader, frame.Type)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(natsMsg.Header))
+
+	if err := b.conn.PublishMsg(natsMsg); err != nil {
+		return fmt.Errorf("failed to publish frame: %w", err)
+	}
+	return nil
+}
+
+// receive passes a message or frame published by any instance to the local broadcast listener.
+func (b *NATSBroadcaster) receive(natsMsg *nats.Msg) {
+	tenantID, err := strconv.Atoi(strings.TrimPrefix(natsMsg.Subject, natsSubjectPrefix))
+	if err != nil {
+		log.Printf("Ignoring NATS message on unexpected subject %s", natsMsg.Subject)
+		return
+	}
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(natsMsg.Header))
+
+	if frameType := natsMsg.Header.Get(natsFrameTypeHeader); frameType != "" {
+		frame := models.TenantFrame{TenantID: tenantID, Type: frameType, Payload: natsMsg.Data}
+		utils.GetBroadcastChannel() <- models.OutboundMessage{Ctx: ctx, Frame: &frame}
+		return
+	}
+
+	var msg models.Message
+	if err := json.Unmarshal(natsMsg.Data, &msg); err != nil {
+		log.Printf("Ignoring invalid NATS message: %v", err)
+		return
+	}
+	msg.TenantID = tenantID // Not part of the JSON, so taken from the subject
+	utils.GetBroadcastChannel() <- models.OutboundMessage{Ctx: ctx, Message: msg}
+}
+
+// Close unsubscribes and drains the NATS connection.
+func (b *NATSBroadcaster) Close() error {
+	if err := b.sub.Unsubscribe(); err != nil {
+		log.Printf("Failed to unsubscribe from NATS: %v", err)
+	}
+	return b.conn.Drain()
+}
@@ -0,0 +1,96 @@
+package broadcast
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"go-chat-app/frames"
+	"go-chat-app/models"
+	"go-chat-app/protocol"
+	"go-chat-app/utils"
+)
+
+// Live server health for admins. Every statsInterval each admin connection that agreed to stats frames is sent its
+// tenant's figures, so an admin UI can show them without polling.
+
+// statsInterval is how often stats frames are sent
+const statsInterval = 5 * time.Second
+
+// messageCounts counts messages fanned out per tenant since the last stats frame
+var messageCounts = struct {
+	sync.Mutex
+	counts map[int]int
+}{counts: make(map[int]int)}
+
+// countMessage records a message fanned out to a tenant.
+func countMessage(tenantID int) {
+	messageCounts.Lock()
+	messageCounts.counts[tenantID]++
+	messageCounts.Unlock()
+}
+
+// takeMessageCounts returns the message counts and starts counting again.
+func takeMessageCounts() map[int]int {
+	messageCounts.Lock()
+	defer messageCounts.Unlock()
+	counts := messageCounts.counts
+	messageCounts.counts = make(map[int]int)
+	return counts
+}
+
+// StartStatsPublisher sends stats frames to admins until the process exits.
+func StartStatsPublisher() {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for now := range ticker.C {
+		publishStats(now, now.Sub(last))
+		last = now
+	}
+}
+
+// publishStats sends each tenant's admins the figures for the period just ended. A panic only skips this update.
+func publishStats(now time.Time, elapsed time.Duration) {
+	defer utils.Recover("stats publisher")
+
+	counts := takeMessageCounts()
+	stats := utils.CollectStats(now)
+
+	tenantFrames := make(map[int]*frames.Frame)
+	defer func() {
+		for _, frame := range tenantFrames {
+			frame.Release()
+		}
+	}()
+
+	var unresponsive []*models.Client
+	utils.ForEachClient(func(client *models.Client) {
+		if !client.IsAdmin || !client.Capabilities().Supports(protocol.TypeStats) {
+			return
+		}
+
+		// Only encoded for tenants with an admin listening
+		frame, ok := tenantFrames[client.TenantID]
+		if !ok {
+			tenantStats := stats[client.TenantID]
+			if tenantStats == nil { // Connected since the stats were collected
+				tenantStats = &models.Stats{Type: protocol.TypeStats, Timestamp: now}
+			}
+			tenantStats.MessagesPerSecond = float64(counts[client.TenantID]) / elapsed.Seconds()
+			var err error
+			if frame, err = frames.Marshal(tenantStats); err != nil {
+				log.Printf("Failed to encode stats frame: %v", err)
+			}
+			tenantFrames[client.TenantID] = frame
+		}
+		if frame != nil && !frame.TrySend(client.Send) {
+			unresponsive = append(unresponsive, client)
+		}
+	})
+
+	for _, client := range unresponsive {
+		utils.DeregisterClient(client)
+	}
+}
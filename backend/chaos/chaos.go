@@ -0,0 +1,18 @@
+package chaos
+
+// Chaos mode injects artificial latency, dropped frames and random disconnects into the hub's outbound path, for
+// testing client reconnect logic and server resilience. It is only compiled in with the "chaos" build tag:
+//
+//	go build -tags chaos -o go-chat-app main.go
+//
+// and is then configured with CHAOS_LATENCY_MS, CHAOS_JITTER_MS, CHAOS_DROP_RATE and CHAOS_DISCONNECT_RATE (0 to 1).
+// Normal builds use no-op stubs so chaos can't be switched on in production by configuration alone.
+
+// Action is what should happen to an outbound frame.
+type Action int
+
+const (
+	Deliver    Action = iota // Send the frame as normal
+	Drop                     // Silently drop the frame
+	Disconnect               // Drop the frame and close the client's connection
+)
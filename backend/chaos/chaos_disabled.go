@@ -0,0 +1,8 @@
+//go:build !chaos
+
+package chaos
+
+// BeforeSend always delivers when chaos mode isn't compiled in.
+func BeforeSend() Action {
+	return Deliver
+}
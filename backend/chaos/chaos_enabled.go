@@ -0,0 +1,61 @@
+//go:build chaos
+
+package chaos
+
+import (
+	"log"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"time"
+)
+
+type config struct {
+	latency        time.Duration
+	jitter         time.Duration
+	dropRate       float64
+	disconnectRate float64
+}
+
+var settings = loadConfig()
+
+func loadConfig() config {
+	c := config{
+		latency:        time.Duration(envFloat("CHAOS_LATENCY_MS", 0)) * time.Millisecond,
+		jitter:         time.Duration(envFloat("CHAOS_JITTER_MS", 0)) * time.Millisecond,
+		dropRate:       envFloat("CHAOS_DROP_RATE", 0),
+		disconnectRate: envFloat("CHAOS_DISCONNECT_RATE", 0),
+	}
+	log.Printf("CHAOS MODE ENABLED: latency=%v jitter=%v drop=%.2f disconnect=%.2f",
+		c.latency, c.jitter, c.dropRate, c.disconnectRate)
+	return c
+}
+
+// BeforeSend sleeps for the configured latency then decides whether an outbound frame is delivered.
+func BeforeSend() Action {
+	delay := settings.latency
+	if settings.jitter > 0 {
+		delay += rand.N(settings.jitter)
+	}
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+
+	roll := rand.Float64()
+	switch {
+	case roll < settings.disconnectRate:
+		return Disconnect
+	case roll < settings.disconnectRate+settings.dropRate:
+		return Drop
+	default:
+		return Deliver
+	}
+}
+
+func envFloat(name string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
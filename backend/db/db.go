@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -9,21 +10,65 @@ import (
 	"time"
 
 	"go-chat-app/models"
+	"go-chat-app/protocol"
+	"go-chat-app/usernames"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/go-sql-driver/mysql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
+// ErrMessageNotFound is returned when a message doesn't exist in the tenant.
+var ErrMessageNotFound = errors.New("message not found")
+
 // DBInterface defines database operations.
 // Defines an interface that represents the database operations available. This allows us to decouple the application logic from our specific database implementation making a db switch easier.
 type DBInterface interface {
-	SaveMessage(msg models.Message) error
-	GetChatHistory() ([]models.Message, error)
-	DeleteAllMessages() error
-	SaveUser(username, hashedPassword string) error
-	GetUserByUsername(username string) (models.User, error)
+	SaveMessage(msg models.Message) (int, error)
+	ToggleReaction(tenantID, messageID, userID int, emoji string) (added bool, count int, err error)
+	GetReactions(tenantID int, messageIDs []int) (map[int][]models.ReactionCount, error)
+	GetChatHistory(tenantID int) ([]models.Message, error)
+	GetMessagesBetween(tenantID int, from, to time.Time) ([]models.Message, error)
+	DeleteAllMessages(tenantID int) error
+	SaveUser(tenantID int, username, hashedPassword string) error
+	GetMembers(tenantID int) ([]models.User, error)
+	SetDisplayName(userID int, displayName string) error
+	SetEmail(userID int, email string) error
+	GetUserByUsername(tenantID int, username string) (models.User, error)
+	UpdateLastSeen(userID int, at time.Time) error
+	DeactivateUser(userID int, at time.Time) error
+	ReactivateUser(userID int) error
+	GetPreferences(userID int) (models.Preferences, bool, error)
+	SavePreferences(userID int, prefs models.Preferences) error
 	UpdateSessionAndCSRF(userID int, sessionToken, csrfToken string) error
 	ClearSession(userID int) error
 	GetUserBySessionToken(sessionToken string) (models.User, error)
+	GetTenantByHostname(hostname string) (models.Tenant, error)
+	GetTenantByAPIKey(apiKey string) (models.Tenant, error)
+	GetMOTD(tenantID int) (models.MOTD, error)
+	SetMOTD(tenantID int, message, updatedBy string) error
+	ClearMOTD(tenantID int) error
+	GetFeatureFlags(tenantID int) ([]models.FeatureFlag, error)
+	SetFeatureFlag(tenantID int, flag models.FeatureFlag) error
+	DeleteFeatureFlag(tenantID int, name string) error
+	SaveEvent(event models.Event) (int, error)
+	GetUpcomingEvents(tenantID int) ([]models.Event, error)
+	CancelEvent(tenantID, eventID int) error
+	GetPendingEvents(before time.Time) ([]models.Event, error)
+	MarkEventReminded(eventID int) error
+	MarkEventAnnounced(eventID int) error
+	GetMessagesAfter(afterID, limit int) ([]models.Message, error)
+	GetOutboxCursor(sink string) (int, error)
+	SetOutboxCursor(sink string, messageID int) error
+	GetMessagesBefore(before time.Time, limit int) ([]models.Message, error)
+	DeleteMessagesThrough(tenantID, lastMessageID int, before time.Time) error
+	SaveMessageArchive(archive models.MessageArchive) error
+	GetMessageArchives(tenantID int) ([]models.MessageArchive, error)
+	GetMessageArchive(tenantID, archiveID int) (models.MessageArchive, error)
+
+	// WithTx runs fn in a transaction, committing if it returns nil and rolling back if it returns an error or panics.
+	// fn must only use the DBInterface it is given. Calling WithTx inside fn joins the outer transaction.
+	WithTx(fn func(tx DBInterface) error) error
 }
 
 // MySQLDB implements DBInterface (by having the same methods) for a MySQL database.
@@ -31,12 +76,37 @@ type DBInterface interface {
 // This encapsulate the database connection (*sql.DB) inside a struct, instead of relying on a global variable.
 // Doing so ensures stateful management of the database connection.
 type MySQLDB struct {
-	db *sql.DB
+	db   executor // The connection pool, or a transaction inside WithTx
+	pool *sql.DB  // Nil inside WithTx
 }
 
+// executor runs queries. Both *sql.DB and *sql.Tx implement it, so methods work the same inside a transaction.
+type executor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// transaction is a transaction begun by a method that needs several statements to be atomic.
+type transaction interface {
+	executor
+	Commit() error
+	Rollback() error
+}
+
+// joinedTx runs a method's statements in the WithTx transaction it was called in. Committing and rolling back are
+// left to WithTx.
+type joinedTx struct {
+	executor
+}
+
+func (joinedTx) Commit() error   { return nil }
+func (joinedTx) Rollback() error { return nil }
+
 // NewMySQLDB creates a new instance of MySQLDB with a live mysql database connection.
 func NewMySQLDB(dsn string) (*MySQLDB, error) {
-	db, err := sql.Open("mysql", dsn)
+	// otelsql wraps the driver so every query is recorded as a tracing span
+	db, err := otelsql.Open("mysql", dsn, otelsql.WithAttributes(semconv.DBSystemMySQL))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open DB connection: %w", err)
 	}
@@ -53,22 +123,151 @@ func NewMySQLDB(dsn string) (*MySQLDB, error) {
 		return nil, fmt.Errorf("could not connect to database after 10 attempts: %w", err)
 	}
 
-	return &MySQLDB{db: db}, nil
+	return &MySQLDB{db: db, pool: db}, nil
+}
+
+// WithTx runs fn in a transaction.
+func (m *MySQLDB) WithTx(fn func(tx DBInterface) error) error {
+	if m.pool == nil {
+		return fn(m)
+	}
+
+	tx, err := m.pool.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once committed, and rolls back if fn panics
+
+	if err := fn(&MySQLDB{db: tx}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// begin begins a transaction for a method, or joins the WithTx transaction the method was called in.
+func (m *MySQLDB) begin() (transaction, error) {
+	if m.pool == nil {
+		return joinedTx{m.db}, nil
+	}
+	return m.pool.Begin()
 }
 
-// SaveMessage saves a chat message to the database.
-func (m *MySQLDB) SaveMessage(msg models.Message) error { // Method receiver used here. m is convention or db
+// SaveMessage saves a chat message, which must already have its ID, to the database and returns its ID.
+func (m *MySQLDB) SaveMessage(msg models.Message) (int, error) { // Method receiver used here. m is convention or db
+	if msg.ID == 0 {
+		return 0, errors.New("message has no ID, IDs are assigned at intake")
+	}
 	_, err := m.db.Exec(
-		"INSERT INTO messages (sender, content, timestamp) VALUES (?, ?, ?)",
-		msg.Sender, msg.Content, msg.Timestamp,
+		"INSERT INTO messages (id, tenant_id, type, sender, language, content, highlighted, verified, timestamp) VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)",
+		msg.ID, msg.TenantID, msg.Type, msg.Sender, msg.Language, msg.Content, msg.Highlighted, msg.Verified, msg.Timestamp,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return msg.ID, nil
+}
+
+// ToggleReaction adds a user's reaction to a message, or removes it if they already reacted with the emoji.
+// Returns whether it was added and how many users now react with the emoji.
+func (m *MySQLDB) ToggleReaction(tenantID, messageID, userID int, emoji string) (bool, int, error) {
+	tx, err := m.begin()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM messages WHERE id = ? AND tenant_id = ?)", messageID, tenantID).Scan(&exists)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to check message %d: %w", messageID, err)
+	}
+	if !exists {
+		return false, 0, ErrMessageNotFound
+	}
+
+	result, err := tx.Exec("DELETE FROM message_reactions WHERE message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to remove reaction: %w", err)
+	}
+	removed, _ := result.RowsAffected()
+
+	// The primary key keeps reactions unique per user, message and emoji, even if two toggles race
+	added := false
+	if removed == 0 {
+		result, err = tx.Exec("INSERT IGNORE INTO message_reactions (message_id, user_id, emoji) VALUES (?, ?, ?)", messageID, userID, emoji)
+		if err != nil {
+			return false, 0, fmt.Errorf("failed to add reaction: %w", err)
+		}
+		inserted, _ := result.RowsAffected()
+		added = inserted == 1
+	}
+
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM message_reactions WHERE message_id = ? AND emoji = ?", messageID, emoji).Scan(&count)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to count reactions: %w", err)
+	}
+
+	return added, count, tx.Commit()
+}
+
+// GetReactions gets the reactions to a set of a tenant's messages in one query, keyed by message ID
+func (m *MySQLDB) GetReactions(tenantID int, messageIDs []int) (map[int][]models.ReactionCount, error) {
+	reactions := make(map[int][]models.ReactionCount)
+	if len(messageIDs) == 0 {
+		return reactions, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(messageIDs)), ", ")
+	args := []any{tenantID}
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+
+	rows, err := m.db.Query(
+		`SELECT r.message_id, r.emoji, u.username
+         FROM message_reactions r
+         JOIN messages m ON m.id = r.message_id
+         JOIN users u ON u.id = r.user_id
+         WHERE m.tenant_id = ? AND r.message_id IN (`+placeholders+`)
+         ORDER BY r.message_id, r.created_at`,
+		args...,
 	)
-	return err
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int
+		var emoji, username string
+		if err := rows.Scan(&messageID, &emoji, &username); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		reactions[messageID] = addReaction(reactions[messageID], emoji, username)
+	}
+	return reactions, rows.Err()
 }
 
-// GetChatHistory retrieves chat history messages from the database.
-func (m *MySQLDB) GetChatHistory() ([]models.Message, error) {
+// addReaction adds a user's reaction to a message's reaction counts, keeping emojis in the order first used.
+func addReaction(counts []models.ReactionCount, emoji, username string) []models.ReactionCount {
+	for i := range counts {
+		if counts[i].Emoji == emoji {
+			counts[i].Count++
+			counts[i].Users = append(counts[i].Users, username)
+			return counts
+		}
+	}
+	return append(counts, models.ReactionCount{Emoji: emoji, Count: 1, Users: []string{username}})
+}
+
+// GetChatHistory retrieves a tenant's chat history messages from the database.
+func (m *MySQLDB) GetChatHistory(tenantID int) ([]models.Message, error) {
 	log.Println("Attempting to get chat history from MySQL database.")
-	rows, err := m.db.Query("SELECT sender, content, timestamp FROM messages ORDER BY timestamp ASC")
+	rows, err := m.db.Query("SELECT id, tenant_id, type, sender, language, content, COALESCE(highlighted, ''), verified, timestamp FROM messages WHERE tenant_id = ? ORDER BY id ASC", tenantID)
 	if err != nil {
 		log.Printf("SQL error: %v", err)
 		return nil, err
@@ -80,7 +279,7 @@ func (m *MySQLDB) GetChatHistory() ([]models.Message, error) {
 	var messages []models.Message
 	for rows.Next() {
 		var msg models.Message
-		err := rows.Scan(&msg.Sender, &msg.Content, &msg.Timestamp)
+		err := rows.Scan(&msg.ID, &msg.TenantID, &msg.Type, &msg.Sender, &msg.Language, &msg.Content, &msg.Highlighted, &msg.Verified, &msg.Timestamp)
 		if err != nil {
 			log.Printf("Row scan error: %v", err)
 			log.Printf("Debugging row: sender=%v, content=%v, timestamp=%v", msg.Sender, msg.Content, msg.Timestamp)
@@ -105,9 +304,9 @@ func (m *MySQLDB) GetChatHistory() ([]models.Message, error) {
 	return messages, nil
 }
 
-// DeleteAllMessages deletes all chat messages from the database
-func (m *MySQLDB) DeleteAllMessages() error {
-	_, err := m.db.Exec("DELETE FROM messages")
+// DeleteAllMessages deletes all of a tenant's chat messages from the database
+func (m *MySQLDB) DeleteAllMessages(tenantID int) error {
+	_, err := m.db.Exec("DELETE FROM messages WHERE tenant_id = ?", tenantID)
 	if err != nil {
 		return fmt.Errorf("failed to delete all messages: %w", err)
 	}
@@ -115,10 +314,10 @@ func (m *MySQLDB) DeleteAllMessages() error {
 }
 
 // SaveUser saves user and security information to the database
-func (m *MySQLDB) SaveUser(username, hashedPassword string) error {
+func (m *MySQLDB) SaveUser(tenantID int, username, hashedPassword string) error {
 	_, err := m.db.Exec(
-		"INSERT INTO users (username, hashed_password) VALUES (?, ?)",
-		username, hashedPassword,
+		"INSERT INTO users (tenant_id, username, username_key, hashed_password) VALUES (?, ?, ?, ?)",
+		tenantID, username, usernames.Key(username), hashedPassword,
 	)
 	if err != nil {
 		if strings.Contains(err.Error(), "Duplicate entry") {
@@ -129,25 +328,109 @@ func (m *MySQLDB) SaveUser(username, hashedPassword string) error {
 	return nil
 }
 
-// GetUserByUsername will get a user from a username
-func (m *MySQLDB) GetUserByUsername(username string) (models.User, error) {
+// GetUserByUsername will get a user from a username within a tenant. Usernames are matched case-insensitively
+func (m *MySQLDB) GetUserByUsername(tenantID int, username string) (models.User, error) {
 	var user models.User
+	var lastSeenAt, deactivatedAt sql.NullTime
 	err := m.db.QueryRow(
-		`SELECT id, username, hashed_password,
+		`SELECT id, tenant_id, username, COALESCE(display_name, ''), COALESCE(email, ''), hashed_password,
                 COALESCE(session_token, '') AS session_token,
-                COALESCE(csrf_token, '') AS csrf_token
-         FROM users WHERE username = ?`,
-		username,
-	).Scan(&user.ID, &user.Username, &user.HashedPassword, &user.SessionToken, &user.CSRFToken)
+                COALESCE(csrf_token, '') AS csrf_token,
+                last_seen_at, deactivated_at
+         FROM users WHERE tenant_id = ? AND username_key = ?`,
+		tenantID, usernames.Key(username),
+	).Scan(&user.ID, &user.TenantID, &user.Username, &user.DisplayName, &user.Email, &user.HashedPassword, &user.SessionToken, &user.CSRFToken, &lastSeenAt, &deactivatedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.User{}, fmt.Errorf("user not found: %w", err)
 		}
 		return models.User{}, fmt.Errorf("failed to retrieve user: %w", err)
 	}
+	if lastSeenAt.Valid {
+		user.LastSeenAt = &lastSeenAt.Time
+	}
+	if deactivatedAt.Valid {
+		user.DeactivatedAt = &deactivatedAt.Time
+	}
 	return user, nil
 }
 
+// GetMembers gets the names and roles of every user in a tenant, for checking new names against
+func (m *MySQLDB) GetMembers(tenantID int) ([]models.User, error) {
+	rows, err := m.db.Query("SELECT id, tenant_id, username, COALESCE(display_name, ''), is_admin FROM users WHERE tenant_id = ?", tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.TenantID, &user.Username, &user.DisplayName, &user.IsAdmin); err != nil {
+			return nil, fmt.Errorf("failed to scan member: %w", err)
+		}
+		members = append(members, user)
+	}
+	return members, rows.Err()
+}
+
+// SetDisplayName sets the name shown for a user instead of their username, or clears it if empty
+func (m *MySQLDB) SetDisplayName(userID int, displayName string) error {
+	_, err := m.db.Exec("UPDATE users SET display_name = NULLIF(?, '') WHERE id = ?", displayName, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set display name for user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// SetEmail sets the address emails for a user are sent to, or clears it if empty
+func (m *MySQLDB) SetEmail(userID int, email string) error {
+	_, err := m.db.Exec("UPDATE users SET email = NULLIF(?, '') WHERE id = ?", email, userID)
+	if err != nil {
+		return fmt.Errorf("failed to set email for user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// UpdateLastSeen records when a user was last connected
+func (m *MySQLDB) UpdateLastSeen(userID int, at time.Time) error {
+	_, err := m.db.Exec("UPDATE users SET last_seen_at = ? WHERE id = ?", at, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update last seen for user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// GetPreferences gets a user's preferences, reporting false if they have never saved any
+func (m *MySQLDB) GetPreferences(userID int) (models.Preferences, bool, error) {
+	var prefs models.Preferences
+	var data []byte
+	err := m.db.QueryRow("SELECT preferences FROM users WHERE id = ?", userID).Scan(&data)
+	if err != nil {
+		return prefs, false, fmt.Errorf("failed to get preferences for user %d: %w", userID, err)
+	}
+	if data == nil {
+		return prefs, false, nil
+	}
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return prefs, false, fmt.Errorf("failed to decode preferences for user %d: %w", userID, err)
+	}
+	return prefs, true, nil
+}
+
+// SavePreferences replaces a user's preferences
+func (m *MySQLDB) SavePreferences(userID int, prefs models.Preferences) error {
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return fmt.Errorf("failed to encode preferences: %w", err)
+	}
+	_, err = m.db.Exec("UPDATE users SET preferences = ? WHERE id = ?", data, userID)
+	if err != nil {
+		return fmt.Errorf("failed to save preferences for user %d: %w", userID, err)
+	}
+	return nil
+}
+
 // UpdateSessionAndCSRF will update he sessions and csrf token information for a given user in the database
 func (m *MySQLDB) UpdateSessionAndCSRF(userID int, sessionToken, csrfToken string) error {
 	_, err := m.db.Exec(
@@ -172,13 +455,34 @@ func (m *MySQLDB) ClearSession(userID int) error {
 	return nil
 }
 
+// DeactivateUser deactivates a user's account and revokes their session
+func (m *MySQLDB) DeactivateUser(userID int, at time.Time) error {
+	_, err := m.db.Exec(
+		"UPDATE users SET deactivated_at = ?, session_token = '', csrf_token = '' WHERE id = ?",
+		at, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to deactivate user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// ReactivateUser reactivates a deactivated user's account so they can log in again
+func (m *MySQLDB) ReactivateUser(userID int) error {
+	_, err := m.db.Exec("UPDATE users SET deactivated_at = NULL WHERE id = ?", userID)
+	if err != nil {
+		return fmt.Errorf("failed to reactivate user %d: %w", userID, err)
+	}
+	return nil
+}
+
 // Gets a user from their session token
 func (m *MySQLDB) GetUserBySessionToken(sessionToken string) (models.User, error) {
 	var user models.User
 	err := m.db.QueryRow(
-		"SELECT id, username, session_token, csrf_token FROM users WHERE session_token = ?",
+		"SELECT id, tenant_id, username, COALESCE(display_name, ''), COALESCE(email, ''), session_token, csrf_token, is_admin FROM users WHERE session_token = ? AND deactivated_at IS NULL",
 		sessionToken,
-	).Scan(&user.ID, &user.Username, &user.SessionToken, &user.CSRFToken)
+	).Scan(&user.ID, &user.TenantID, &user.Username, &user.DisplayName, &user.Email, &user.SessionToken, &user.CSRFToken, &user.IsAdmin)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return models.User{}, fmt.Errorf("session token not found: %w", err)
@@ -187,3 +491,383 @@ func (m *MySQLDB) GetUserBySessionToken(sessionToken string) (models.User, error
 	}
 	return user, nil
 }
+
+// GetTenantByHostname gets the tenant serving a given hostname
+func (m *MySQLDB) GetTenantByHostname(hostname string) (models.Tenant, error) {
+	return m.getTenant("hostname", hostname)
+}
+
+// GetTenantByAPIKey gets the tenant that owns an API key
+func (m *MySQLDB) GetTenantByAPIKey(apiKey string) (models.Tenant, error) {
+	return m.getTenant("api_key", apiKey)
+}
+
+// GetMOTD gets a tenant's message of the day, with empty content if none is set
+func (m *MySQLDB) GetMOTD(tenantID int) (models.MOTD, error) {
+	motd := models.MOTD{Type: protocol.TypeMOTD, Sender: "System"}
+	err := m.db.QueryRow("SELECT message, updated_by, updated_at FROM motd WHERE tenant_id = ?", tenantID).
+		Scan(&motd.Content, &motd.UpdatedBy, &motd.Timestamp)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return motd, fmt.Errorf("failed to get message of the day: %w", err)
+	}
+	return motd, nil
+}
+
+// SetMOTD sets a tenant's message of the day
+func (m *MySQLDB) SetMOTD(tenantID int, message, updatedBy string) error {
+	_, err := m.db.Exec(
+		`INSERT INTO motd (tenant_id, message, updated_by) VALUES (?, ?, ?)
+         ON DUPLICATE KEY UPDATE message = VALUES(message), updated_by = VALUES(updated_by)`,
+		tenantID, message, updatedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set message of the day: %w", err)
+	}
+	return nil
+}
+
+// ClearMOTD removes a tenant's message of the day
+func (m *MySQLDB) ClearMOTD(tenantID int) error {
+	_, err := m.db.Exec("DELETE FROM motd WHERE tenant_id = ?", tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to clear message of the day: %w", err)
+	}
+	return nil
+}
+
+// GetFeatureFlags gets the feature flags a tenant has configured, with the users each is always on for
+func (m *MySQLDB) GetFeatureFlags(tenantID int) ([]models.FeatureFlag, error) {
+	rows, err := m.db.Query(
+		"SELECT name, enabled, percentage, updated_by, updated_at FROM feature_flags WHERE tenant_id = ? ORDER BY name",
+		tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feature flags: %w", err)
+	}
+	defer rows.Close()
+
+	flags := []models.FeatureFlag{}
+	index := make(map[string]int)
+	for rows.Next() {
+		flag := models.FeatureFlag{Users: []string{}}
+		if err := rows.Scan(&flag.Name, &flag.Enabled, &flag.Percentage, &flag.UpdatedBy, &flag.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan feature flag: %w", err)
+		}
+		index[flag.Name] = len(flags)
+		flags = append(flags, flag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get feature flags: %w", err)
+	}
+
+	userRows, err := m.db.Query(
+		`SELECT f.name, u.id, u.username FROM feature_flag_users f
+         JOIN users u ON u.id = f.user_id
+         WHERE f.tenant_id = ? ORDER BY u.username`,
+		tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feature flag users: %w", err)
+	}
+	defer userRows.Close()
+
+	for userRows.Next() {
+		var name, username string
+		var userID int
+		if err := userRows.Scan(&name, &userID, &username); err != nil {
+			return nil, fmt.Errorf("failed to scan feature flag user: %w", err)
+		}
+		if i, ok := index[name]; ok {
+			flags[i].UserIDs = append(flags[i].UserIDs, userID)
+			flags[i].Users = append(flags[i].Users, username)
+		}
+	}
+	return flags, userRows.Err()
+}
+
+// SetFeatureFlag creates or replaces a tenant's setting for a feature flag, including its users
+func (m *MySQLDB) SetFeatureFlag(tenantID int, flag models.FeatureFlag) error {
+	tx, err := m.begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(
+		`INSERT INTO feature_flags (tenant_id, name, enabled, percentage, updated_by) VALUES (?, ?, ?, ?, ?)
+         ON DUPLICATE KEY UPDATE enabled = VALUES(enabled), percentage = VALUES(percentage), updated_by = VALUES(updated_by)`,
+		tenantID, flag.Name, flag.Enabled, flag.Percentage, flag.UpdatedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set feature flag %s: %w", flag.Name, err)
+	}
+
+	if _, err := tx.Exec("DELETE FROM feature_flag_users WHERE tenant_id = ? AND name = ?", tenantID, flag.Name); err != nil {
+		return fmt.Errorf("failed to clear feature flag users: %w", err)
+	}
+	for _, userID := range flag.UserIDs {
+		_, err := tx.Exec("INSERT IGNORE INTO feature_flag_users (tenant_id, name, user_id) VALUES (?, ?, ?)", tenantID, flag.Name, userID)
+		if err != nil {
+			return fmt.Errorf("failed to add feature flag user: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteFeatureFlag removes a tenant's setting for a feature flag, so it goes back to the instance default
+func (m *MySQLDB) DeleteFeatureFlag(tenantID int, name string) error {
+	// Users are removed by the cascading foreign key
+	_, err := m.db.Exec("DELETE FROM feature_flags WHERE tenant_id = ? AND name = ?", tenantID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete feature flag %s: %w", name, err)
+	}
+	return nil
+}
+
+// getTenant looks up a tenant by a unique column. column is never user supplied.
+func (m *MySQLDB) getTenant(column, value string) (models.Tenant, error) {
+	var tenant models.Tenant
+	err := m.db.QueryRow(
+		"SELECT id, name, COALESCE(hostname, ''), COALESCE(api_key, ''), COALESCE(webhook_secret, '') FROM tenants WHERE "+column+" = ?",
+		value,
+	).Scan(&tenant.ID, &tenant.Name, &tenant.Hostname, &tenant.APIKey, &tenant.WebhookSecret)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Tenant{}, fmt.Errorf("tenant not found: %w", err)
+		}
+		return models.Tenant{}, fmt.Errorf("failed to retrieve tenant by %s: %w", column, err)
+	}
+	return tenant, nil
+}
+
+// SaveEvent saves a scheduled event and returns its ID
+func (m *MySQLDB) SaveEvent(event models.Event) (int, error) {
+	result, err := m.db.Exec(
+		"INSERT INTO events (tenant_id, title, starts_at, created_by) VALUES (?, ?, ?, ?)",
+		event.TenantID, event.Title, event.StartsAt, event.CreatedBy,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save event: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get event id: %w", err)
+	}
+	return int(id), nil
+}
+
+// GetUpcomingEvents gets a tenant's events that haven't started yet, soonest first
+func (m *MySQLDB) GetUpcomingEvents(tenantID int) ([]models.Event, error) {
+	rows, err := m.db.Query(
+		`SELECT id, tenant_id, title, starts_at, created_by, reminded, announced
+         FROM events WHERE tenant_id = ? AND cancelled = FALSE AND announced = FALSE ORDER BY starts_at ASC`,
+		tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upcoming events: %w", err)
+	}
+	return scanEvents(rows)
+}
+
+// CancelEvent cancels a tenant's event so it is no longer announced
+func (m *MySQLDB) CancelEvent(tenantID, eventID int) error {
+	result, err := m.db.Exec(
+		"UPDATE events SET cancelled = TRUE WHERE id = ? AND tenant_id = ? AND cancelled = FALSE",
+		eventID, tenantID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to cancel event %d: %w", eventID, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("event %d not found: %w", eventID, sql.ErrNoRows)
+	}
+	return nil
+}
+
+// GetPendingEvents gets events across all tenants starting before the given time that still need a reminder or announcement
+func (m *MySQLDB) GetPendingEvents(before time.Time) ([]models.Event, error) {
+	rows, err := m.db.Query(
+		`SELECT id, tenant_id, title, starts_at, created_by, reminded, announced
+         FROM events WHERE starts_at <= ? AND cancelled = FALSE AND announced = FALSE ORDER BY starts_at ASC`,
+		before,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending events: %w", err)
+	}
+	return scanEvents(rows)
+}
+
+// MarkEventReminded records that the reminder for an event has been sent
+func (m *MySQLDB) MarkEventReminded(eventID int) error {
+	_, err := m.db.Exec("UPDATE events SET reminded = TRUE WHERE id = ?", eventID)
+	if err != nil {
+		return fmt.Errorf("failed to mark event %d reminded: %w", eventID, err)
+	}
+	return nil
+}
+
+// MarkEventAnnounced records that an event has been announced
+func (m *MySQLDB) MarkEventAnnounced(eventID int) error {
+	_, err := m.db.Exec("UPDATE events SET reminded = TRUE, announced = TRUE WHERE id = ?", eventID)
+	if err != nil {
+		return fmt.Errorf("failed to mark event %d announced: %w", eventID, err)
+	}
+	return nil
+}
+
+// scanEvents reads event rows and closes them
+func scanEvents(rows *sql.Rows) ([]models.Event, error) {
+	defer rows.Close()
+
+	events := []models.Event{}
+	for rows.Next() {
+		var event models.Event
+		err := rows.Scan(&event.ID, &event.TenantID, &event.Title, &event.StartsAt, &event.CreatedBy, &event.Reminded, &event.Announced)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// GetMessagesAfter gets up to limit messages across all tenants with IDs after the given one, oldest first
+func (m *MySQLDB) GetMessagesAfter(afterID, limit int) ([]models.Message, error) {
+	rows, err := m.db.Query(
+		"SELECT id, tenant_id, type, sender, language, content, COALESCE(highlighted, ''), verified, timestamp FROM messages WHERE id > ? ORDER BY id ASC LIMIT ?",
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages after %d: %w", afterID, err)
+	}
+	return scanMessages(rows)
+}
+
+// scanMessages reads messages, including their IDs, from query result rows and closes them
+func scanMessages(rows *sql.Rows) ([]models.Message, error) {
+	defer rows.Close()
+
+	messages := []models.Message{}
+	for rows.Next() {
+		var msg models.Message
+		if err := rows.Scan(&msg.ID, &msg.TenantID, &msg.Type, &msg.Sender, &msg.Language, &msg.Content, &msg.Highlighted, &msg.Verified, &msg.Timestamp); err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// GetMessagesBetween gets a tenant's messages sent between from (inclusive) and to (exclusive), oldest first
+func (m *MySQLDB) GetMessagesBetween(tenantID int, from, to time.Time) ([]models.Message, error) {
+	rows, err := m.db.Query(
+		"SELECT id, tenant_id, type, sender, language, content, COALESCE(highlighted, ''), verified, timestamp FROM messages WHERE tenant_id = ? AND timestamp >= ? AND timestamp < ? ORDER BY timestamp ASC",
+		tenantID, from, to,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages between %s and %s: %w", from, to, err)
+	}
+	return scanMessages(rows)
+}
+
+// GetOutboxCursor gets the ID of the last message delivered to an outbox sink, or 0 if it has never delivered any
+func (m *MySQLDB) GetOutboxCursor(sink string) (int, error) {
+	var messageID int
+	err := m.db.QueryRow("SELECT last_message_id FROM outbox_cursors WHERE sink = ?", sink).Scan(&messageID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get outbox cursor for %s: %w", sink, err)
+	}
+	return messageID, nil
+}
+
+// SetOutboxCursor records the ID of the last message delivered to an outbox sink
+func (m *MySQLDB) SetOutboxCursor(sink string, messageID int) error {
+	_, err := m.db.Exec(
+		"INSERT INTO outbox_cursors (sink, last_message_id) VALUES (?, ?) ON DUPLICATE KEY UPDATE last_message_id = VALUES(last_message_id)",
+		sink, messageID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set outbox cursor for %s: %w", sink, err)
+	}
+	return nil
+}
+
+// GetMessagesBefore gets up to limit messages across all tenants sent before the given time, oldest first
+func (m *MySQLDB) GetMessagesBefore(before time.Time, limit int) ([]models.Message, error) {
+	rows, err := m.db.Query(
+		"SELECT id, tenant_id, type, sender, language, content, COALESCE(highlighted, ''), verified, timestamp FROM messages WHERE timestamp < ? ORDER BY id ASC LIMIT ?",
+		before, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages before %v: %w", before, err)
+	}
+	return scanMessages(rows)
+}
+
+// DeleteMessagesThrough deletes a tenant's messages sent before the given time with IDs up to and including lastMessageID
+func (m *MySQLDB) DeleteMessagesThrough(tenantID, lastMessageID int, before time.Time) error {
+	_, err := m.db.Exec(
+		"DELETE FROM messages WHERE tenant_id = ? AND id <= ? AND timestamp < ?",
+		tenantID, lastMessageID, before,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete archived messages: %w", err)
+	}
+	return nil
+}
+
+// SaveMessageArchive records a page of messages moved to cold storage.
+// Saving the same object again is a no-op, so a page re-archived after an interrupted run isn't listed twice.
+func (m *MySQLDB) SaveMessageArchive(archive models.MessageArchive) error {
+	_, err := m.db.Exec(
+		`INSERT IGNORE INTO message_archives (tenant_id, object_key, first_message_id, last_message_id, from_timestamp, to_timestamp, message_count)
+         VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		archive.TenantID, archive.ObjectKey, archive.FirstMessageID, archive.LastMessageID, archive.From, archive.To, archive.MessageCount,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save message archive: %w", err)
+	}
+	return nil
+}
+
+// GetMessageArchives gets a tenant's archived message pages, oldest first
+func (m *MySQLDB) GetMessageArchives(tenantID int) ([]models.MessageArchive, error) {
+	rows, err := m.db.Query(
+		`SELECT id, tenant_id, object_key, first_message_id, last_message_id, from_timestamp, to_timestamp, message_count
+         FROM message_archives WHERE tenant_id = ? ORDER BY first_message_id ASC`,
+		tenantID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message archives: %w", err)
+	}
+	defer rows.Close()
+
+	archives := []models.MessageArchive{}
+	for rows.Next() {
+		var a models.MessageArchive
+		if err := rows.Scan(&a.ID, &a.TenantID, &a.ObjectKey, &a.FirstMessageID, &a.LastMessageID, &a.From, &a.To, &a.MessageCount); err != nil {
+			return nil, fmt.Errorf("failed to scan message archive: %w", err)
+		}
+		archives = append(archives, a)
+	}
+	return archives, rows.Err()
+}
+
+// GetMessageArchive gets one of a tenant's archived message pages
+func (m *MySQLDB) GetMessageArchive(tenantID, archiveID int) (models.MessageArchive, error) {
+	var a models.MessageArchive
+	err := m.db.QueryRow(
+		`SELECT id, tenant_id, object_key, first_message_id, last_message_id, from_timestamp, to_timestamp, message_count
+         FROM message_archives WHERE tenant_id = ? AND id = ?`,
+		tenantID, archiveID,
+	).Scan(&a.ID, &a.TenantID, &a.ObjectKey, &a.FirstMessageID, &a.LastMessageID, &a.From, &a.To, &a.MessageCount)
+	if err != nil {
+		return a, fmt.Errorf("failed to get message archive %d: %w", archiveID, err)
+	}
+	return a, nil
+}
@@ -3,30 +3,142 @@ package db
 import (
 	"errors"
 	"fmt"
+	"maps"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"go-chat-app/models"
+	"go-chat-app/protocol"
+	"go-chat-app/usernames"
 )
 
 type MockDB struct {
-	mu       sync.Mutex
-	messages []models.Message
-	users    map[string]models.User // keyed by username
-	nextID   int
+	txMu      sync.Mutex // Held for the whole of WithTx, so transactions don't interleave
+	mu        sync.Mutex
+	messages  []models.Message
+	users     map[string]models.User // keyed by userKey(tenantID, username)
+	tenants   []models.Tenant
+	events    []models.Event
+	archives  []models.MessageArchive
+	reactions []mockReaction
+	prefs     map[int]models.Preferences            // keyed by user ID
+	motds     map[int]models.MOTD                   // keyed by tenant ID
+	flags     map[int]map[string]models.FeatureFlag // keyed by tenant ID, then flag name
+	cursors   map[string]int
+	nextID    int
+
+	nextMessageID int
 }
 
 func NewMockDB() *MockDB {
 	return &MockDB{
 		messages: []models.Message{},
 		users:    make(map[string]models.User),
+		tenants:  []models.Tenant{{ID: 1, Name: "default"}},
+		cursors:  make(map[string]int),
+		prefs:    make(map[int]models.Preferences),
+		motds:    make(map[int]models.MOTD),
+		flags:    make(map[int]map[string]models.FeatureFlag),
 		nextID:   1,
+
+		nextMessageID: 1,
 	}
 }
 
-// SaveMessage (mock) stores a chat message in memory.
-func (m *MockDB) SaveMessage(msg models.Message) error {
+// WithTx (mock) runs fn in a transaction. The data is snapshotted first and restored if fn fails, so changes are all
+// or nothing. Unlike MySQL, other callers can see changes before fn returns.
+func (m *MockDB) WithTx(fn func(tx DBInterface) error) (err error) {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	snapshot := m.snapshot()
+	defer func() {
+		if p := recover(); p != nil {
+			m.restore(snapshot)
+			panic(p)
+		}
+		if err != nil {
+			m.restore(snapshot)
+		}
+	}()
+	return fn(mockTx{m})
+}
+
+// mockTx is the MockDB as seen inside WithTx, where calling WithTx again joins the transaction.
+type mockTx struct {
+	*MockDB
+}
+
+func (tx mockTx) WithTx(fn func(tx DBInterface) error) error {
+	return fn(tx)
+}
+
+// snapshot copies the mock's data so a failed transaction can be rolled back.
+func (m *MockDB) snapshot() *MockDB {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	flags := make(map[int]map[string]models.FeatureFlag, len(m.flags))
+	for tenantID, tenantFlags := range m.flags {
+		flags[tenantID] = maps.Clone(tenantFlags)
+	}
+	return &MockDB{
+		messages:      append([]models.Message(nil), m.messages...),
+		users:         maps.Clone(m.users),
+		tenants:       append([]models.Tenant(nil), m.tenants...),
+		events:        append([]models.Event(nil), m.events...),
+		archives:      append([]models.MessageArchive(nil), m.archives...),
+		reactions:     append([]mockReaction(nil), m.reactions...),
+		prefs:         maps.Clone(m.prefs),
+		motds:         maps.Clone(m.motds),
+		flags:         flags,
+		cursors:       maps.Clone(m.cursors),
+		nextID:        m.nextID,
+		nextMessageID: m.nextMessageID,
+	}
+}
+
+// restore puts back the data from a snapshot.
+func (m *MockDB) restore(snapshot *MockDB) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.messages, m.users, m.tenants = snapshot.messages, snapshot.users, snapshot.tenants
+	m.events, m.archives, m.reactions = snapshot.events, snapshot.archives, snapshot.reactions
+	m.prefs, m.motds, m.flags, m.cursors = snapshot.prefs, snapshot.motds, snapshot.flags, snapshot.cursors
+	m.nextID, m.nextMessageID = snapshot.nextID, snapshot.nextMessageID
+}
+
+// userKey builds the users map key, as usernames are only unique (case-insensitively) within a tenant.
+func userKey(tenantID int, username string) string {
+	return fmt.Sprintf("%d:%s", tenantID, usernames.Key(username))
+}
+
+// SetAdmin (mock only) grants or revokes a user's admin role.
+func (m *MockDB) SetAdmin(userID int, isAdmin bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, user := range m.users {
+		if user.ID == userID {
+			user.IsAdmin = isAdmin
+			m.users[key] = user
+		}
+	}
+}
+
+// AddTenant (mock only) adds a tenant for resolution tests.
+func (m *MockDB) AddTenant(tenant models.Tenant) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tenants = append(m.tenants, tenant)
+}
+
+// SaveMessage (mock) stores a chat message in memory. Messages without an ID are given the next one, for tests.
+func (m *MockDB) SaveMessage(msg models.Message) (int, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -34,64 +146,187 @@ func (m *MockDB) SaveMessage(msg models.Message) error {
 	if msg.Timestamp.IsZero() {
 		msg.Timestamp = time.Now()
 	}
+	if msg.ID == 0 {
+		msg.ID = m.nextMessageID
+		m.nextMessageID++
+	}
 	m.messages = append(m.messages, msg)
-	return nil
+	return msg.ID, nil
+}
+
+// mockReaction is a row of the mock's message_reactions table.
+type mockReaction struct {
+	messageID int
+	userID    int
+	emoji     string
+}
+
+// ToggleReaction (mock) adds a user's reaction to a message, or removes it if they already reacted with the emoji.
+func (m *MockDB) ToggleReaction(tenantID, messageID, userID int, emoji string) (bool, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	found := false
+	for _, msg := range m.messages {
+		if msg.ID == messageID && msg.TenantID == tenantID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return false, 0, ErrMessageNotFound
+	}
+
+	added := true
+	for i, r := range m.reactions {
+		if r.messageID == messageID && r.userID == userID && r.emoji == emoji {
+			m.reactions = append(m.reactions[:i], m.reactions[i+1:]...)
+			added = false
+			break
+		}
+	}
+	if added {
+		m.reactions = append(m.reactions, mockReaction{messageID: messageID, userID: userID, emoji: emoji})
+	}
+
+	count := 0
+	for _, r := range m.reactions {
+		if r.messageID == messageID && r.emoji == emoji {
+			count++
+		}
+	}
+	return added, count, nil
+}
+
+// GetReactions (mock) gets the reactions to a set of a tenant's messages, keyed by message ID.
+func (m *MockDB) GetReactions(tenantID int, messageIDs []int) (map[int][]models.ReactionCount, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[int]bool)
+	for _, msg := range m.messages {
+		if msg.TenantID == tenantID {
+			wanted[msg.ID] = false
+		}
+	}
+	for _, id := range messageIDs {
+		if _, ok := wanted[id]; ok {
+			wanted[id] = true
+		}
+	}
+
+	usernames := make(map[int]string)
+	for _, user := range m.users {
+		usernames[user.ID] = user.Username
+	}
+
+	reactions := make(map[int][]models.ReactionCount)
+	for _, r := range m.reactions {
+		if wanted[r.messageID] {
+			reactions[r.messageID] = addReaction(reactions[r.messageID], r.emoji, usernames[r.userID])
+		}
+	}
+	return reactions, nil
 }
 
-// GetChatHistory (mock) retrieves all stored messages.
-func (m *MockDB) GetChatHistory() ([]models.Message, error) {
+// GetChatHistory (mock) retrieves all stored messages for a tenant.
+func (m *MockDB) GetChatHistory(tenantID int) ([]models.Message, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Return a copy to avoid external modification
-	history := make([]models.Message, len(m.messages))
-	copy(history, m.messages)
+	history := []models.Message{}
+	for _, msg := range m.messages {
+		if msg.TenantID == tenantID {
+			history = append(history, msg)
+		}
+	}
 	return history, nil
 }
 
-// DeleteAllMessages (mock) clears all messages.
-func (m *MockDB) DeleteAllMessages() error {
+// DeleteAllMessages (mock) clears all messages for a tenant.
+func (m *MockDB) DeleteAllMessages(tenantID int) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	m.messages = []models.Message{}
+	remaining := []models.Message{}
+	for _, msg := range m.messages {
+		if msg.TenantID != tenantID {
+			remaining = append(remaining, msg)
+		}
+	}
+	m.messages = remaining
 	return nil
 }
 
 // SaveUser (mock) saves a new user if it does not already exist.
-func (m *MockDB) SaveUser(username, hashedPassword string) error {
+func (m *MockDB) SaveUser(tenantID int, username, hashedPassword string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Check for existing user
-	if _, exists := m.users[username]; exists {
+	if _, exists := m.users[userKey(tenantID, username)]; exists {
 		return fmt.Errorf("username already exists")
 	}
 
 	user := models.User{
 		ID:             m.nextID,
+		TenantID:       tenantID,
 		Username:       username,
 		HashedPassword: hashedPassword,
 		SessionToken:   "",
 		CSRFToken:      "",
 	}
-	m.users[username] = user
+	m.users[userKey(tenantID, username)] = user
 	m.nextID++
 	return nil
 }
 
-// GetUserByUsername (mock) retrieves a user by username.
-func (m *MockDB) GetUserByUsername(username string) (models.User, error) {
+// GetUserByUsername (mock) retrieves a user by username within a tenant.
+func (m *MockDB) GetUserByUsername(tenantID int, username string) (models.User, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	user, exists := m.users[username]
+	user, exists := m.users[userKey(tenantID, username)]
 	if !exists {
 		return models.User{}, errors.New("user not found")
 	}
 	return user, nil
 }
 
+// UpdateLastSeen (mock) records when a user was last connected.
+func (m *MockDB) UpdateLastSeen(userID int, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, user := range m.users {
+		if user.ID == userID {
+			user.LastSeenAt = &at
+			m.users[key] = user
+			return nil
+		}
+	}
+	return errors.New("user not found")
+}
+
+// GetPreferences (mock) gets a user's preferences, reporting false if none were saved.
+func (m *MockDB) GetPreferences(userID int) (models.Preferences, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prefs, ok := m.prefs[userID]
+	return prefs, ok, nil
+}
+
+// SavePreferences (mock) replaces a user's preferences.
+func (m *MockDB) SavePreferences(userID int, prefs models.Preferences) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prefs[userID] = prefs
+	return nil
+}
+
 // UpdateSessionAndCSRF (mock) updates the session and CSRF token for a given user.
 func (m *MockDB) UpdateSessionAndCSRF(userID int, sessionToken, csrfToken string) error {
 	m.mu.Lock()
@@ -144,16 +379,374 @@ func (m *MockDB) ClearSession(userID int) error {
 	return nil
 }
 
+// GetMembers (mock) gets every user in a tenant.
+func (m *MockDB) GetMembers(tenantID int) ([]models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var members []models.User
+	for _, user := range m.users {
+		if user.TenantID == tenantID {
+			members = append(members, user)
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members, nil
+}
+
+// SetDisplayName (mock) sets or clears the name shown for a user instead of their username.
+func (m *MockDB) SetDisplayName(userID int, displayName string) error {
+	return m.updateUser(userID, func(user *models.User) {
+		user.DisplayName = displayName
+	})
+}
+
+// SetEmail (mock) sets or clears the address emails for a user are sent to.
+func (m *MockDB) SetEmail(userID int, email string) error {
+	return m.updateUser(userID, func(user *models.User) {
+		user.Email = email
+	})
+}
+
+// DeactivateUser (mock) deactivates a user's account and revokes their session.
+func (m *MockDB) DeactivateUser(userID int, at time.Time) error {
+	return m.updateUser(userID, func(user *models.User) {
+		user.DeactivatedAt = &at
+		user.SessionToken = ""
+		user.CSRFToken = ""
+	})
+}
+
+// ReactivateUser (mock) reactivates a deactivated user's account.
+func (m *MockDB) ReactivateUser(userID int) error {
+	return m.updateUser(userID, func(user *models.User) {
+		user.DeactivatedAt = nil
+	})
+}
+
+// updateUser applies an update to the user with the given ID.
+func (m *MockDB) updateUser(userID int, update func(*models.User)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for key, user := range m.users {
+		if user.ID == userID {
+			update(&user)
+			m.users[key] = user
+			return nil
+		}
+	}
+	return errors.New("user not found")
+}
+
 // GetUserBySessionToken (mock) retrieves a user by their session token.
 func (m *MockDB) GetUserBySessionToken(sessionToken string) (models.User, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	for _, user := range m.users {
-		if strings.TrimSpace(user.SessionToken) == strings.TrimSpace(sessionToken) && sessionToken != "" {
+		if strings.TrimSpace(user.SessionToken) == strings.TrimSpace(sessionToken) && sessionToken != "" && user.DeactivatedAt == nil {
 			return user, nil
 		}
 	}
 
 	return models.User{}, errors.New("session token not found")
 }
+
+// GetTenantByHostname (mock) retrieves a tenant by hostname.
+func (m *MockDB) GetTenantByHostname(hostname string) (models.Tenant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, tenant := range m.tenants {
+		if tenant.Hostname != "" && tenant.Hostname == hostname {
+			return tenant, nil
+		}
+	}
+	return models.Tenant{}, errors.New("tenant not found")
+}
+
+// GetMOTD (mock) gets a tenant's message of the day.
+func (m *MockDB) GetMOTD(tenantID int) (models.MOTD, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if motd, ok := m.motds[tenantID]; ok {
+		return motd, nil
+	}
+	return models.MOTD{Type: protocol.TypeMOTD, Sender: "System"}, nil
+}
+
+// SetMOTD (mock) sets a tenant's message of the day.
+func (m *MockDB) SetMOTD(tenantID int, message, updatedBy string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.motds[tenantID] = models.MOTD{Type: protocol.TypeMOTD, Sender: "System", Content: message, UpdatedBy: updatedBy, Timestamp: time.Now()}
+	return nil
+}
+
+// ClearMOTD (mock) removes a tenant's message of the day.
+func (m *MockDB) ClearMOTD(tenantID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.motds, tenantID)
+	return nil
+}
+
+// GetFeatureFlags (mock) gets the feature flags a tenant has configured.
+func (m *MockDB) GetFeatureFlags(tenantID int) ([]models.FeatureFlag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usernamesByID := make(map[int]string)
+	for _, user := range m.users {
+		usernamesByID[user.ID] = user.Username
+	}
+
+	flags := []models.FeatureFlag{}
+	for _, flag := range m.flags[tenantID] {
+		flag.UserIDs = append([]int(nil), flag.UserIDs...)
+		flag.Users = []string{}
+		for _, userID := range flag.UserIDs {
+			flag.Users = append(flag.Users, usernamesByID[userID])
+		}
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+	return flags, nil
+}
+
+// SetFeatureFlag (mock) creates or replaces a tenant's setting for a feature flag.
+func (m *MockDB) SetFeatureFlag(tenantID int, flag models.FeatureFlag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.flags[tenantID] == nil {
+		m.flags[tenantID] = make(map[string]models.FeatureFlag)
+	}
+	flag.UserIDs = append([]int(nil), flag.UserIDs...)
+	flag.Users = nil
+	flag.UpdatedAt = time.Now()
+	m.flags[tenantID][flag.Name] = flag
+	return nil
+}
+
+// DeleteFeatureFlag (mock) removes a tenant's setting for a feature flag.
+func (m *MockDB) DeleteFeatureFlag(tenantID int, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.flags[tenantID], name)
+	return nil
+}
+
+// GetTenantByAPIKey (mock) retrieves a tenant by API key.
+func (m *MockDB) GetTenantByAPIKey(apiKey string) (models.Tenant, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, tenant := range m.tenants {
+		if tenant.APIKey != "" && tenant.APIKey == apiKey {
+			return tenant, nil
+		}
+	}
+	return models.Tenant{}, errors.New("tenant not found")
+}
+
+// SaveEvent (mock) stores a scheduled event.
+func (m *MockDB) SaveEvent(event models.Event) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event.ID = len(m.events) + 1
+	m.events = append(m.events, event)
+	return event.ID, nil
+}
+
+// GetUpcomingEvents (mock) retrieves a tenant's events that haven't been announced, soonest first.
+func (m *MockDB) GetUpcomingEvents(tenantID int) ([]models.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []models.Event{}
+	for _, event := range m.events {
+		if event.TenantID == tenantID && !event.Announced && !event.Cancelled {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].StartsAt.Before(events[j].StartsAt) })
+	return events, nil
+}
+
+// CancelEvent (mock) cancels a tenant's event.
+func (m *MockDB) CancelEvent(tenantID, eventID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, event := range m.events {
+		if event.ID == eventID && event.TenantID == tenantID && !event.Cancelled {
+			m.events[i].Cancelled = true
+			return nil
+		}
+	}
+	return errors.New("event not found")
+}
+
+// GetPendingEvents (mock) retrieves events starting before a time that haven't been announced.
+func (m *MockDB) GetPendingEvents(before time.Time) ([]models.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []models.Event{}
+	for _, event := range m.events {
+		if !event.Announced && !event.Cancelled && !event.StartsAt.After(before) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// MarkEventReminded (mock) records that an event's reminder was sent.
+func (m *MockDB) MarkEventReminded(eventID int) error {
+	return m.updateEvent(eventID, func(event *models.Event) { event.Reminded = true })
+}
+
+// MarkEventAnnounced (mock) records that an event was announced.
+func (m *MockDB) MarkEventAnnounced(eventID int) error {
+	return m.updateEvent(eventID, func(event *models.Event) {
+		event.Reminded = true
+		event.Announced = true
+	})
+}
+
+// updateEvent (mock) applies an update to the event with the given ID.
+func (m *MockDB) updateEvent(eventID int, update func(*models.Event)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.events {
+		if m.events[i].ID == eventID {
+			update(&m.events[i])
+			return nil
+		}
+	}
+	return errors.New("event not found")
+}
+
+// GetMessagesAfter (mock) gets up to limit messages across all tenants with IDs after the given one.
+func (m *MockDB) GetMessagesAfter(afterID, limit int) ([]models.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := []models.Message{}
+	for _, msg := range m.messages {
+		if msg.ID > afterID && len(messages) < limit {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+// GetOutboxCursor (mock) gets the ID of the last message delivered to a sink.
+func (m *MockDB) GetOutboxCursor(sink string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.cursors[sink], nil
+}
+
+// SetOutboxCursor (mock) records the ID of the last message delivered to a sink.
+func (m *MockDB) SetOutboxCursor(sink string, messageID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cursors[sink] = messageID
+	return nil
+}
+
+// GetMessagesBefore (mock) gets up to limit messages across all tenants sent before the given time.
+func (m *MockDB) GetMessagesBefore(before time.Time, limit int) ([]models.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := []models.Message{}
+	for _, msg := range m.messages {
+		if msg.Timestamp.Before(before) && len(messages) < limit {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+// GetMessagesBetween (mock) gets a tenant's messages sent between from (inclusive) and to (exclusive).
+func (m *MockDB) GetMessagesBetween(tenantID int, from, to time.Time) ([]models.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messages := []models.Message{}
+	for _, msg := range m.messages {
+		if msg.TenantID == tenantID && !msg.Timestamp.Before(from) && msg.Timestamp.Before(to) {
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+// DeleteMessagesThrough (mock) deletes a tenant's messages sent before the given time with IDs up to lastMessageID.
+func (m *MockDB) DeleteMessagesThrough(tenantID, lastMessageID int, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	remaining := []models.Message{}
+	for _, msg := range m.messages {
+		if msg.TenantID != tenantID || msg.ID > lastMessageID || !msg.Timestamp.Before(before) {
+			remaining = append(remaining, msg)
+		}
+	}
+	m.messages = remaining
+	return nil
+}
+
+// SaveMessageArchive (mock) records an archived page, ignoring pages already recorded.
+func (m *MockDB) SaveMessageArchive(archive models.MessageArchive) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.archives {
+		if existing.ObjectKey == archive.ObjectKey {
+			return nil
+		}
+	}
+	archive.ID = len(m.archives) + 1
+	m.archives = append(m.archives, archive)
+	return nil
+}
+
+// GetMessageArchives (mock) gets a tenant's archived pages.
+func (m *MockDB) GetMessageArchives(tenantID int) ([]models.MessageArchive, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	archives := []models.MessageArchive{}
+	for _, archive := range m.archives {
+		if archive.TenantID == tenantID {
+			archives = append(archives, archive)
+		}
+	}
+	return archives, nil
+}
+
+// GetMessageArchive (mock) gets one of a tenant's archived pages.
+func (m *MockDB) GetMessageArchive(tenantID, archiveID int) (models.MessageArchive, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, archive := range m.archives {
+		if archive.TenantID == tenantID && archive.ID == archiveID {
+			return archive, nil
+		}
+	}
+	return models.MessageArchive{}, errors.New("archive not found")
+}
@@ -1,6 +1,7 @@
 package db_test
 
 import (
+	"errors"
 	"testing"
 	"time"
 
@@ -13,17 +14,18 @@ import (
 func TestSaveMessage(t *testing.T) {
 	mockDB := db.NewMockDB()
 	msg := models.Message{
+		TenantID:  1,
 		Sender:    "user1",
 		Content:   "Hello, World!",
 		Timestamp: time.Now(),
 	}
 
-	err := mockDB.SaveMessage(msg)
+	_, err := mockDB.SaveMessage(msg)
 	if err != nil {
 		t.Fatalf("SaveMessage failed: %v", err)
 	}
 
-	history, _ := mockDB.GetChatHistory()
+	history, _ := mockDB.GetChatHistory(1)
 	if len(history) != 1 {
 		t.Fatalf("Expected 1 message, got %d", len(history))
 	}
@@ -34,13 +36,13 @@ func TestSaveMessage(t *testing.T) {
 
 func TestGetChatHistory(t *testing.T) {
 	mockDB := db.NewMockDB()
-	msg1 := models.Message{Sender: "user1", Content: "Hi!", Timestamp: time.Now()}
-	msg2 := models.Message{Sender: "user2", Content: "Hello!", Timestamp: time.Now()}
+	msg1 := models.Message{TenantID: 1, Sender: "user1", Content: "Hi!", Timestamp: time.Now()}
+	msg2 := models.Message{TenantID: 1, Sender: "user2", Content: "Hello!", Timestamp: time.Now()}
 
 	mockDB.SaveMessage(msg1)
 	mockDB.SaveMessage(msg2)
 
-	history, err := mockDB.GetChatHistory()
+	history, err := mockDB.GetChatHistory(1)
 	if err != nil {
 		t.Fatalf("GetChatHistory failed: %v", err)
 	}
@@ -53,11 +55,11 @@ func TestDeleteAllMessages(t *testing.T) {
 	mockDB := db.NewMockDB()
 
 	// Add some messages
-	mockDB.SaveMessage(models.Message{Sender: "user1", Content: "Hello!", Timestamp: time.Now()})
-	mockDB.SaveMessage(models.Message{Sender: "user2", Content: "Hi there!", Timestamp: time.Now()})
+	mockDB.SaveMessage(models.Message{TenantID: 1, Sender: "user1", Content: "Hello!", Timestamp: time.Now()})
+	mockDB.SaveMessage(models.Message{TenantID: 1, Sender: "user2", Content: "Hi there!", Timestamp: time.Now()})
 
 	// Verify messages were added
-	history, err := mockDB.GetChatHistory()
+	history, err := mockDB.GetChatHistory(1)
 	if err != nil {
 		t.Fatalf("GetChatHistory failed: %v", err)
 	}
@@ -66,13 +68,13 @@ func TestDeleteAllMessages(t *testing.T) {
 	}
 
 	// Delete all messages
-	err = mockDB.DeleteAllMessages()
+	err = mockDB.DeleteAllMessages(1)
 	if err != nil {
 		t.Fatalf("DeleteAllMessages failed: %v", err)
 	}
 
 	// Verify all messages were deleted
-	history, err = mockDB.GetChatHistory()
+	history, err = mockDB.GetChatHistory(1)
 	if err != nil {
 		t.Fatalf("GetChatHistory failed after deletion: %v", err)
 	}
@@ -84,12 +86,12 @@ func TestDeleteAllMessages(t *testing.T) {
 func TestSaveUser(t *testing.T) {
 	mockDB := db.NewMockDB()
 
-	err := mockDB.SaveUser("user1", "hashedpassword123")
+	err := mockDB.SaveUser(1, "user1", "hashedpassword123")
 	if err != nil {
 		t.Fatalf("SaveUser failed: %v", err)
 	}
 
-	err = mockDB.SaveUser("user1", "anotherpassword")
+	err = mockDB.SaveUser(1, "user1", "anotherpassword")
 	if err == nil {
 		t.Fatal("Expected error for duplicate username, got nil")
 	}
@@ -97,9 +99,9 @@ func TestSaveUser(t *testing.T) {
 
 func TestGetUserByUsername(t *testing.T) {
 	mockDB := db.NewMockDB()
-	mockDB.SaveUser("user1", "hashedpassword123")
+	mockDB.SaveUser(1, "user1", "hashedpassword123")
 
-	user, err := mockDB.GetUserByUsername("user1")
+	user, err := mockDB.GetUserByUsername(1, "user1")
 	if err != nil {
 		t.Fatalf("GetUserByUsername failed: %v", err)
 	}
@@ -107,7 +109,7 @@ func TestGetUserByUsername(t *testing.T) {
 		t.Errorf("Expected username 'user1', got '%s'", user.Username)
 	}
 
-	_, err = mockDB.GetUserByUsername("nonexistent")
+	_, err = mockDB.GetUserByUsername(1, "nonexistent")
 	if err == nil {
 		t.Fatal("Expected error for nonexistent user, got nil")
 	}
@@ -115,15 +117,15 @@ func TestGetUserByUsername(t *testing.T) {
 
 func TestUpdateSessionAndCSRF(t *testing.T) {
 	mockDB := db.NewMockDB()
-	mockDB.SaveUser("user1", "hashedpassword123")
-	user, _ := mockDB.GetUserByUsername("user1")
+	mockDB.SaveUser(1, "user1", "hashedpassword123")
+	user, _ := mockDB.GetUserByUsername(1, "user1")
 
 	err := mockDB.UpdateSessionAndCSRF(user.ID, "session123", "csrf123")
 	if err != nil {
 		t.Fatalf("UpdateSessionAndCSRF failed: %v", err)
 	}
 
-	updatedUser, _ := mockDB.GetUserByUsername("user1")
+	updatedUser, _ := mockDB.GetUserByUsername(1, "user1")
 	if updatedUser.SessionToken != "session123" || updatedUser.CSRFToken != "csrf123" {
 		t.Error("Session and CSRF tokens were not updated correctly")
 	}
@@ -131,13 +133,13 @@ func TestUpdateSessionAndCSRF(t *testing.T) {
 
 func TestClearSession(t *testing.T) {
 	mockDB := db.NewMockDB()
-	mockDB.SaveUser("user1", "hashedpassword123")
-	user, _ := mockDB.GetUserByUsername("user1")
+	mockDB.SaveUser(1, "user1", "hashedpassword123")
+	user, _ := mockDB.GetUserByUsername(1, "user1")
 
 	mockDB.UpdateSessionAndCSRF(user.ID, "session123", "csrf123")
 	mockDB.ClearSession(user.ID)
 
-	updatedUser, _ := mockDB.GetUserByUsername("user1")
+	updatedUser, _ := mockDB.GetUserByUsername(1, "user1")
 	if updatedUser.SessionToken != "" || updatedUser.CSRFToken != "" {
 		t.Error("Session and CSRF tokens were not cleared correctly")
 	}
@@ -145,8 +147,8 @@ func TestClearSession(t *testing.T) {
 
 func TestGetUserBySessionToken(t *testing.T) {
 	mockDB := db.NewMockDB()
-	mockDB.SaveUser("user1", "hashedpassword123")
-	user, _ := mockDB.GetUserByUsername("user1")
+	mockDB.SaveUser(1, "user1", "hashedpassword123")
+	user, _ := mockDB.GetUserByUsername(1, "user1")
 
 	mockDB.UpdateSessionAndCSRF(user.ID, "session123", "csrf123")
 	retrievedUser, err := mockDB.GetUserBySessionToken("session123")
@@ -162,3 +164,179 @@ func TestGetUserBySessionToken(t *testing.T) {
 		t.Fatal("Expected error for invalid session token, got nil")
 	}
 }
+
+func TestUpdateLastSeen(t *testing.T) {
+	mockDB := db.NewMockDB()
+	mockDB.SaveUser(1, "user1", "hashedpassword123")
+	user, _ := mockDB.GetUserByUsername(1, "user1")
+	if user.LastSeenAt != nil {
+		t.Fatalf("Expected no last seen time for a new user, got %v", user.LastSeenAt)
+	}
+
+	seenAt := time.Now()
+	if err := mockDB.UpdateLastSeen(user.ID, seenAt); err != nil {
+		t.Fatalf("UpdateLastSeen failed: %v", err)
+	}
+
+	updatedUser, _ := mockDB.GetUserByUsername(1, "user1")
+	if updatedUser.LastSeenAt == nil || !updatedUser.LastSeenAt.Equal(seenAt) {
+		t.Errorf("Expected last seen %v, got %v", seenAt, updatedUser.LastSeenAt)
+	}
+}
+
+func TestMOTD(t *testing.T) {
+	mockDB := db.NewMockDB()
+
+	motd, err := mockDB.GetMOTD(1)
+	if err != nil || motd.Content != "" {
+		t.Fatalf("Expected no message of the day, got %+v (%v)", motd, err)
+	}
+
+	mockDB.SetMOTD(1, "Welcome!", "admin")
+	motd, _ = mockDB.GetMOTD(1)
+	if motd.Content != "Welcome!" || motd.UpdatedBy != "admin" || motd.Type != "motd" {
+		t.Errorf("Expected message of the day to be set, got %+v", motd)
+	}
+
+	// Other tenants are unaffected
+	if other, _ := mockDB.GetMOTD(2); other.Content != "" {
+		t.Errorf("Expected no message of the day for another tenant, got %q", other.Content)
+	}
+
+	mockDB.ClearMOTD(1)
+	if motd, _ = mockDB.GetMOTD(1); motd.Content != "" {
+		t.Errorf("Expected message of the day to be cleared, got %q", motd.Content)
+	}
+}
+
+func TestToggleReaction(t *testing.T) {
+	mockDB := db.NewMockDB()
+	mockDB.SaveUser(1, "user1", "hashedpassword")
+	mockDB.SaveUser(1, "user2", "hashedpassword")
+	user1, _ := mockDB.GetUserByUsername(1, "user1")
+	user2, _ := mockDB.GetUserByUsername(1, "user2")
+	messageID, _ := mockDB.SaveMessage(models.Message{TenantID: 1, Sender: "user1", Content: "Hello"})
+
+	added, count, err := mockDB.ToggleReaction(1, messageID, user1.ID, "👍")
+	if err != nil || !added || count != 1 {
+		t.Fatalf("Expected reaction to be added with count 1, got added=%v count=%d (%v)", added, count, err)
+	}
+	added, count, _ = mockDB.ToggleReaction(1, messageID, user2.ID, "👍")
+	if !added || count != 2 {
+		t.Errorf("Expected second user's reaction to be added with count 2, got added=%v count=%d", added, count)
+	}
+
+	// Toggling again removes only that user's reaction
+	added, count, _ = mockDB.ToggleReaction(1, messageID, user1.ID, "👍")
+	if added || count != 1 {
+		t.Errorf("Expected reaction to be removed with count 1, got added=%v count=%d", added, count)
+	}
+
+	// Messages in other tenants can't be reacted to
+	if _, _, err := mockDB.ToggleReaction(2, messageID, user1.ID, "👍"); !errors.Is(err, db.ErrMessageNotFound) {
+		t.Errorf("Expected ErrMessageNotFound for another tenant, got %v", err)
+	}
+}
+
+func TestGetReactions(t *testing.T) {
+	mockDB := db.NewMockDB()
+	mockDB.SaveUser(1, "user1", "hashedpassword")
+	user, _ := mockDB.GetUserByUsername(1, "user1")
+	first, _ := mockDB.SaveMessage(models.Message{TenantID: 1, Sender: "user1", Content: "First"})
+	second, _ := mockDB.SaveMessage(models.Message{TenantID: 1, Sender: "user1", Content: "Second"})
+
+	mockDB.ToggleReaction(1, first, user.ID, "👍")
+	mockDB.ToggleReaction(1, first, user.ID, "🎉")
+	mockDB.ToggleReaction(1, second, user.ID, "👍")
+
+	reactions, err := mockDB.GetReactions(1, []int{first})
+	if err != nil {
+		t.Fatalf("GetReactions failed: %v", err)
+	}
+	if _, ok := reactions[second]; ok {
+		t.Errorf("Expected only requested messages, got reactions for message %d", second)
+	}
+	got := reactions[first]
+	if len(got) != 2 || got[0].Emoji != "👍" || got[1].Emoji != "🎉" {
+		t.Fatalf("Expected 👍 then 🎉, got %+v", got)
+	}
+	if got[0].Count != 1 || len(got[0].Users) != 1 || got[0].Users[0] != "user1" {
+		t.Errorf("Expected one reaction from user1, got %+v", got[0])
+	}
+
+	// Other tenants see nothing
+	if other, _ := mockDB.GetReactions(2, []int{first, second}); len(other) != 0 {
+		t.Errorf("Expected no reactions for another tenant, got %+v", other)
+	}
+}
+
+func TestWithTx_Commit(t *testing.T) {
+	mockDB := db.NewMockDB()
+
+	err := mockDB.WithTx(func(tx db.DBInterface) error {
+		if err := tx.SaveUser(1, "alice", "hash"); err != nil {
+			return err
+		}
+		user, err := tx.GetUserByUsername(1, "alice")
+		if err != nil {
+			return err
+		}
+		return tx.SavePreferences(user.ID, models.Preferences{TimeZone: "UTC"})
+	})
+	if err != nil {
+		t.Fatalf("WithTx() error = %v", err)
+	}
+
+	user, err := mockDB.GetUserByUsername(1, "alice")
+	if err != nil {
+		t.Fatalf("user not committed: %v", err)
+	}
+	if _, ok, _ := mockDB.GetPreferences(user.ID); !ok {
+		t.Error("preferences not committed")
+	}
+}
+
+func TestWithTx_RollbackOnError(t *testing.T) {
+	mockDB := db.NewMockDB()
+	mockDB.SaveMessage(models.Message{TenantID: 1, Content: "kept"})
+	failure := errors.New("second step failed")
+
+	err := mockDB.WithTx(func(tx db.DBInterface) error {
+		tx.SaveUser(1, "alice", "hash")
+		tx.SaveMessage(models.Message{TenantID: 1, Content: "rolled back"})
+		// Nested transactions join the outer one, so are rolled back with it
+		return tx.WithTx(func(tx db.DBInterface) error {
+			tx.SetMOTD(1, "rolled back", "admin")
+			return failure
+		})
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("WithTx() error = %v, want %v", err, failure)
+	}
+
+	if _, err := mockDB.GetUserByUsername(1, "alice"); err == nil {
+		t.Error("user from the failed transaction was kept")
+	}
+	if history, _ := mockDB.GetChatHistory(1); len(history) != 1 || history[0].Content != "kept" {
+		t.Errorf("history = %v, want only the message saved before the transaction", history)
+	}
+	if motd, _ := mockDB.GetMOTD(1); motd.Content != "" {
+		t.Error("message of the day from the failed transaction was kept")
+	}
+}
+
+func TestWithTx_RollbackOnPanic(t *testing.T) {
+	mockDB := db.NewMockDB()
+
+	func() {
+		defer func() { recover() }()
+		mockDB.WithTx(func(tx db.DBInterface) error {
+			tx.SaveUser(1, "alice", "hash")
+			panic("boom")
+		})
+	}()
+
+	if _, err := mockDB.GetUserByUsername(1, "alice"); err == nil {
+		t.Error("user from the panicked transaction was kept")
+	}
+}
@@ -0,0 +1,79 @@
+package embedding
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Embed mode allows the chat widget to be iframed on third-party sites.
+// Each embedding site (identified by its origin) is issued an embed key. The parent page hands the key to the
+// iframe using window.postMessage, which also gives the iframe a browser verified origin for the parent page.
+// The widget then passes both to the WebSocket handshake as embed_origin and embed_key query parameters.
+
+// Config holds the embed keys for each allowed embedding origin.
+type Config struct {
+	keys map[string]string // Keyed by embedding origin, e.g. "https://example.com"
+}
+
+// LoadConfig reads embed keys from the EMBED_KEYS environment variable.
+// The expected format is a comma separated list of origin=key pairs, e.g. "https://a.com=key1,https://b.com=key2"
+func LoadConfig() *Config {
+	return ParseKeys(os.Getenv("EMBED_KEYS"))
+}
+
+// ParseKeys parses a comma separated list of origin=key pairs into a Config.
+func ParseKeys(raw string) *Config {
+	config := &Config{keys: make(map[string]string)}
+
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		// Split on the last "=" because origins can't contain one but may contain ":" for ports
+		i := strings.LastIndex(pair, "=")
+		if i <= 0 || i == len(pair)-1 {
+			log.Printf("Ignoring invalid embed key entry: %q", pair)
+			continue
+		}
+		config.keys[strings.TrimSuffix(pair[:i], "/")] = pair[i+1:]
+	}
+
+	return config
+}
+
+// Enabled reports whether any embedding origins have been configured.
+func (c *Config) Enabled() bool {
+	return len(c.keys) > 0
+}
+
+// ValidateHandshake checks the embed origin and key on a WebSocket handshake request.
+// Requests without an embed_origin are not embedded and are always allowed.
+func (c *Config) ValidateHandshake(r *http.Request) error {
+	origin := strings.TrimSuffix(r.URL.Query().Get("embed_origin"), "/")
+	if origin == "" {
+		return nil
+	}
+
+	if !c.Enabled() {
+		return errors.New("embed mode is not enabled")
+	}
+
+	expected, ok := c.keys[origin]
+	if !ok {
+		return errors.New("embed origin not allowed")
+	}
+
+	// Constant time compare so the key can't be guessed from response timings
+	key := r.URL.Query().Get("embed_key")
+	if subtle.ConstantTimeCompare([]byte(key), []byte(expected)) != 1 {
+		return errors.New("invalid embed key")
+	}
+
+	return nil
+}
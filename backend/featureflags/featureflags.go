@@ -0,0 +1,222 @@
+package featureflags
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-chat-app/db"
+	"go-chat-app/models"
+	"go-chat-app/protocol"
+	"go-chat-app/validation"
+)
+
+// Feature flags let features be rolled out gradually. Tenant admins turn each flag on or off for their tenant, and
+// while it's on can limit it to a percentage of users, plus a list of users who always get it. Flags a tenant hasn't
+// configured use the instance defaults from FEATURE_FLAGS (e.g. "reactions=off"), falling back to each flag's
+// built in default.
+//
+// Tenant settings are cached for a short time, so a change made on one instance reaches the others within cacheTTL.
+
+// Flags known to the server
+const (
+	Reactions = "reactions"
+)
+
+// builtin holds each flag's default. Features that existed before their flag default to on, so upgrading doesn't
+// turn them off.
+var builtin = map[string]bool{
+	Reactions: true,
+}
+
+// frameFlags maps WebSocket frame types to the flag gating them
+var frameFlags = map[string]string{
+	protocol.TypeReaction: Reactions,
+}
+
+// cacheTTL is how long a tenant's flags are cached for
+const cacheTTL = 30 * time.Second
+
+// Names returns the names of the known flags, sorted.
+func Names() []string {
+	names := make([]string, 0, len(builtin))
+	for name := range builtin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Known reports whether a flag exists.
+func Known(name string) bool {
+	_, ok := builtin[name]
+	return ok
+}
+
+// FrameFlag returns the flag gating a frame type, reporting false if the frame type isn't gated.
+func FrameFlag(frameType string) (string, bool) {
+	name, ok := frameFlags[frameType]
+	return name, ok
+}
+
+// Evaluate reports whether a flag is on for a user. Users are bucketed by a hash of the flag name and their user ID,
+// so a user consistently gets the same answer and raising the percentage only ever adds users. Guests have no user ID
+// so only get flags rolled out to everyone.
+func Evaluate(flag models.FeatureFlag, userID int) bool {
+	if !flag.Enabled {
+		return false
+	}
+	if flag.Percentage >= 100 || slices.Contains(flag.UserIDs, userID) {
+		return true
+	}
+	if userID == 0 {
+		return false
+	}
+	return bucket(flag.Name, userID) < flag.Percentage
+}
+
+// bucket maps a user to a number from 0 to 99 for a flag.
+func bucket(name string, userID int) int {
+	h := fnv.New32a()
+	h.Write([]byte(name + ":" + strconv.Itoa(userID)))
+	return int(h.Sum32() % 100)
+}
+
+// LoadDefaults reads the instance defaults from FEATURE_FLAGS, a comma separated list of name=on or name=off.
+func LoadDefaults() (map[string]bool, error) {
+	defaults := make(map[string]bool)
+	for _, entry := range strings.Split(os.Getenv("FEATURE_FLAGS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !Known(name) {
+			return nil, fmt.Errorf("unknown feature flag %q", name)
+		}
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "on", "true", "1":
+			defaults[name] = true
+		case "off", "false", "0":
+			defaults[name] = false
+		default:
+			return nil, fmt.Errorf("feature flag %s must be on or off, got %q", name, value)
+		}
+	}
+	return defaults, nil
+}
+
+// Validate checks a flag setting from an admin, returning an error for each invalid field.
+func Validate(flag models.FeatureFlag) []validation.FieldError {
+	var errs []validation.FieldError
+	if flag.Percentage < 0 || flag.Percentage > 100 {
+		errs = append(errs, validation.FieldError{Field: "percentage", Message: "must be from 0 to 100"})
+	}
+	return errs
+}
+
+// Flags looks up and caches tenants' flag settings. A nil *Flags treats every flag as its built in default.
+type Flags struct {
+	db       db.DBInterface
+	defaults map[string]bool
+
+	mu      sync.Mutex
+	tenants map[int]tenantFlags
+}
+
+type tenantFlags struct {
+	flags    map[string]models.FeatureFlag
+	loadedAt time.Time
+}
+
+// New creates a Flags using the instance defaults for flags tenants haven't configured.
+func New(database db.DBInterface, defaults map[string]bool) *Flags {
+	return &Flags{db: database, defaults: defaults, tenants: make(map[int]tenantFlags)}
+}
+
+// Default returns the setting for a flag a tenant hasn't configured.
+func (f *Flags) Default(name string) models.FeatureFlag {
+	enabled := builtin[name]
+	if f != nil {
+		if value, ok := f.defaults[name]; ok {
+			enabled = value
+		}
+	}
+	return models.FeatureFlag{Name: name, Enabled: enabled, Percentage: 100, Users: []string{}, Default: true}
+}
+
+// Get returns a tenant's setting for a flag. If the settings can't be loaded the default is used.
+func (f *Flags) Get(tenantID int, name string) models.FeatureFlag {
+	if f == nil {
+		return f.Default(name)
+	}
+
+	f.mu.Lock()
+	cached, ok := f.tenants[tenantID]
+	f.mu.Unlock()
+
+	if !ok || time.Since(cached.loadedAt) > cacheTTL {
+		flags, err := f.db.GetFeatureFlags(tenantID)
+		if err != nil {
+			log.Printf("Failed to load feature flags for tenant %d, using defaults: %v", tenantID, err)
+			return f.Default(name)
+		}
+		cached = tenantFlags{flags: make(map[string]models.FeatureFlag), loadedAt: time.Now()}
+		for _, flag := range flags {
+			cached.flags[flag.Name] = flag
+		}
+		f.mu.Lock()
+		f.tenants[tenantID] = cached
+		f.mu.Unlock()
+	}
+
+	if flag, ok := cached.flags[name]; ok {
+		return flag
+	}
+	return f.Default(name)
+}
+
+// Enabled reports whether a flag is on for a user.
+func (f *Flags) Enabled(tenantID, userID int, name string) bool {
+	return Evaluate(f.Get(tenantID, name), userID)
+}
+
+// List returns a tenant's settings for every known flag, including defaults for those it hasn't configured.
+func (f *Flags) List(tenantID int) ([]models.FeatureFlag, error) {
+	configured, err := f.db.GetFeatureFlags(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.FeatureFlag)
+	for _, flag := range configured {
+		byName[flag.Name] = flag
+	}
+
+	flags := make([]models.FeatureFlag, 0, len(builtin))
+	for _, name := range Names() {
+		if flag, ok := byName[name]; ok {
+			flags = append(flags, flag)
+		} else {
+			flags = append(flags, f.Default(name))
+		}
+	}
+	return flags, nil
+}
+
+// Invalidate drops a tenant's cached settings, so changes made on this instance apply straight away.
+func (f *Flags) Invalidate(tenantID int) {
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	delete(f.tenants, tenantID)
+	f.mu.Unlock()
+}
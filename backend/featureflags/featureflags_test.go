@@ -0,0 +1,104 @@
+package featureflags
+
+import (
+	"testing"
+
+	"go-chat-app/db"
+	"go-chat-app/models"
+)
+
+func TestEvaluate(t *testing.T) {
+	off := models.FeatureFlag{Name: Reactions, Enabled: false, Percentage: 100, UserIDs: []int{1}}
+	if Evaluate(off, 1) {
+		t.Error("disabled flag was on for a listed user")
+	}
+
+	everyone := models.FeatureFlag{Name: Reactions, Enabled: true, Percentage: 100}
+	if !Evaluate(everyone, 0) || !Evaluate(everyone, 42) {
+		t.Error("flag at 100% should be on for everyone, including guests")
+	}
+
+	listed := models.FeatureFlag{Name: Reactions, Enabled: true, Percentage: 0, UserIDs: []int{7}}
+	if !Evaluate(listed, 7) || Evaluate(listed, 8) {
+		t.Error("flag at 0% should only be on for listed users")
+	}
+	if Evaluate(models.FeatureFlag{Name: Reactions, Enabled: true, Percentage: 99}, 0) {
+		t.Error("guests should only get flags rolled out to everyone")
+	}
+}
+
+func TestEvaluate_PercentageRollout(t *testing.T) {
+	flag := models.FeatureFlag{Name: Reactions, Enabled: true, Percentage: 25}
+
+	on := make(map[int]bool)
+	for userID := 1; userID <= 1000; userID++ {
+		on[userID] = Evaluate(flag, userID)
+	}
+	count := 0
+	for _, enabled := range on {
+		if enabled {
+			count++
+		}
+	}
+	if count < 200 || count > 300 {
+		t.Errorf("flag at 25%% was on for %d of 1000 users", count)
+	}
+
+	// Raising the percentage only adds users
+	flag.Percentage = 50
+	for userID, enabled := range on {
+		if enabled && !Evaluate(flag, userID) {
+			t.Fatalf("user %d lost the flag when the rollout was raised", userID)
+		}
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	t.Setenv("FEATURE_FLAGS", "reactions=off")
+	defaults, err := LoadDefaults()
+	if err != nil {
+		t.Fatalf("LoadDefaults() error = %v", err)
+	}
+	if enabled, ok := defaults[Reactions]; !ok || enabled {
+		t.Errorf("defaults = %v, want reactions off", defaults)
+	}
+
+	t.Setenv("FEATURE_FLAGS", "threads=on")
+	if _, err := LoadDefaults(); err == nil {
+		t.Error("expected an error for an unknown flag")
+	}
+	t.Setenv("FEATURE_FLAGS", "reactions=maybe")
+	if _, err := LoadDefaults(); err == nil {
+		t.Error("expected an error for an invalid value")
+	}
+}
+
+func TestFlags_GetAndInvalidate(t *testing.T) {
+	mockDB := db.NewMockDB()
+	flags := New(mockDB, map[string]bool{Reactions: false})
+
+	if flag := flags.Get(1, Reactions); flag.Enabled || !flag.Default {
+		t.Errorf("unconfigured flag = %+v, want the instance default (off)", flag)
+	}
+
+	mockDB.SetFeatureFlag(1, models.FeatureFlag{Name: Reactions, Enabled: true, Percentage: 100, UpdatedBy: "admin"})
+	if flags.Enabled(1, 5, Reactions) {
+		t.Error("setting applied before the cache was invalidated")
+	}
+	flags.Invalidate(1)
+	if !flags.Enabled(1, 5, Reactions) {
+		t.Error("setting not applied after invalidating the cache")
+	}
+
+	// Other tenants are unaffected
+	if flags.Enabled(2, 5, Reactions) {
+		t.Error("one tenant's setting applied to another")
+	}
+}
+
+func TestFlags_Nil(t *testing.T) {
+	var flags *Flags
+	if !flags.Enabled(1, 1, Reactions) {
+		t.Error("nil Flags should use the built in default")
+	}
+}
@@ -0,0 +1,92 @@
+package flood
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Flood protection for inbound WebSocket frames. Each connection has a token bucket, by default refilling at 10 frames
+// a second with bursts of up to 20. Frames over the limit are dropped and count as violations, which escalate:
+// the first few get a warning, then the connection is muted for a while, and if it keeps flooding it is disconnected.
+// Violations are forgiven after a period without any.
+
+// Action is what to do with an inbound frame.
+type Action int
+
+const (
+	Allow      Action = iota // Handle the frame
+	Warn                     // Drop the frame and warn the client
+	Mute                     // Drop the frame and tell the client it is muted
+	Muted                    // Drop the frame silently, the client is already muted
+	Disconnect               // Close the connection with a policy violation
+)
+
+// Escalation settings
+const (
+	warnings     = 2                // Violations that only get a warning
+	mutes        = 2                // Further violations that get a mute before disconnecting
+	MuteDuration = 30 * time.Second // How long a mute lasts
+	forgiveAfter = time.Minute      // Violations are forgotten after this long without one
+	defaultRate  = 10
+	defaultBurst = 20
+)
+
+// Config is the inbound frame rate allowed per connection.
+type Config struct {
+	Rate  rate.Limit
+	Burst int
+}
+
+// LoadConfig reads WS_RATE_PER_SECOND and WS_RATE_BURST, defaulting to 10 frames a second with bursts of 20.
+func LoadConfig() Config {
+	c := Config{Rate: defaultRate, Burst: defaultBurst}
+	if perSecond, err := strconv.ParseFloat(os.Getenv("WS_RATE_PER_SECOND"), 64); err == nil && perSecond > 0 {
+		c.Rate = rate.Limit(perSecond)
+	}
+	if burst, err := strconv.Atoi(os.Getenv("WS_RATE_BURST")); err == nil && burst > 0 {
+		c.Burst = burst
+	}
+	return c
+}
+
+// Limiter tracks one connection's frame rate and violations. It is only used by the connection's read loop.
+type Limiter struct {
+	bucket        *rate.Limiter
+	violations    int
+	lastViolation time.Time
+	mutedUntil    time.Time
+}
+
+// NewLimiter creates a limiter for a new connection.
+func (c Config) NewLimiter() *Limiter {
+	return &Limiter{bucket: rate.NewLimiter(c.Rate, c.Burst)}
+}
+
+// Check decides what to do with a frame received at the given time.
+func (l *Limiter) Check(now time.Time) Action {
+	if now.Before(l.mutedUntil) {
+		return Muted
+	}
+	if l.bucket.AllowN(now, 1) {
+		return Allow
+	}
+
+	if now.Sub(l.lastViolation) > forgiveAfter {
+		l.violations = 0
+	}
+	l.violations++
+	l.lastViolation = now
+
+	switch {
+	case l.violations <= warnings:
+		return Warn
+	case l.violations <= warnings+mutes:
+		l.mutedUntil = now.Add(MuteDuration)
+		return Mute
+	default:
+		return Disconnect
+	}
+}
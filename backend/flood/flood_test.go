@@ -0,0 +1,59 @@
+package flood_test
+
+import (
+	"testing"
+	"time"
+
+	"go-chat-app/flood"
+)
+
+func TestLimiter_Escalates(t *testing.T) {
+	limiter := flood.Config{Rate: 1, Burst: 2}.NewLimiter()
+	now := time.Now()
+
+	// The burst is allowed
+	for i := 0; i < 2; i++ {
+		if action := limiter.Check(now); action != flood.Allow {
+			t.Fatalf("expected frame %d to be allowed, got %v", i, action)
+		}
+	}
+
+	// Then warnings, a mute, and frames dropped while muted
+	expect := func(at time.Time, want flood.Action) {
+		t.Helper()
+		if action := limiter.Check(at); action != want {
+			t.Fatalf("expected %v, got %v", want, action)
+		}
+	}
+	expect(now, flood.Warn)
+	expect(now, flood.Warn)
+	expect(now, flood.Mute)
+	expect(now.Add(time.Second), flood.Muted)
+
+	// After the mute, flooding again mutes once more and then disconnects
+	afterMute := now.Add(flood.MuteDuration + time.Second)
+	expect(afterMute, flood.Allow)
+	expect(afterMute, flood.Allow)
+	expect(afterMute, flood.Mute)
+	afterSecondMute := afterMute.Add(flood.MuteDuration + time.Second)
+	expect(afterSecondMute, flood.Allow)
+	expect(afterSecondMute, flood.Allow)
+	expect(afterSecondMute, flood.Disconnect)
+}
+
+func TestLimiter_ForgivesOldViolations(t *testing.T) {
+	limiter := flood.Config{Rate: 1, Burst: 1}.NewLimiter()
+	now := time.Now()
+
+	limiter.Check(now)
+	if action := limiter.Check(now); action != flood.Warn {
+		t.Fatalf("expected a warning, got %v", action)
+	}
+
+	// Long after the last violation, a new one starts again with a warning
+	later := now.Add(5 * time.Minute)
+	limiter.Check(later)
+	if action := limiter.Check(later); action != flood.Warn {
+		t.Errorf("expected violations to be forgiven, got %v", action)
+	}
+}
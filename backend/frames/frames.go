@@ -0,0 +1,73 @@
+package frames
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+)
+
+// Outbound WebSocket frames. A broadcast message is encoded once into a pooled buffer that is shared by every
+// recipient's send queue rather than copied per client. The frame is reference counted: each holder calls Release
+// when done with it, and the last release returns the buffer to the pool for the next message.
+
+// Frame is an encoded outbound frame shared between the clients it is sent to.
+type Frame struct {
+	buf     bytes.Buffer
+	encoder *json.Encoder
+	refs    atomic.Int32
+}
+
+var pool = sync.Pool{
+	New: func() any {
+		f := &Frame{}
+		f.encoder = json.NewEncoder(&f.buf)
+		f.encoder.SetEscapeHTML(false) // Highlighted code is HTML, escaping it would only bloat frames
+		return f
+	},
+}
+
+// Marshal encodes v as JSON into a pooled frame holding one reference, owned by the caller.
+func Marshal(v any) (*Frame, error) {
+	f := pool.Get().(*Frame)
+	f.buf.Reset()
+	if err := f.encoder.Encode(v); err != nil {
+		pool.Put(f)
+		return nil, err
+	}
+	f.buf.Truncate(f.buf.Len() - 1) // Encode adds a trailing newline
+	f.refs.Store(1)
+	return f, nil
+}
+
+// Bytes returns the encoded frame. Only valid until the caller's reference is released.
+func (f *Frame) Bytes() []byte {
+	return f.buf.Bytes()
+}
+
+// Retain adds a reference, which must be taken before handing the frame to another goroutine.
+func (f *Frame) Retain() {
+	f.refs.Add(1)
+}
+
+// Release drops a reference, returning the frame to the pool once none remain.
+func (f *Frame) Release() {
+	switch refs := f.refs.Add(-1); {
+	case refs == 0:
+		pool.Put(f)
+	case refs < 0:
+		panic("frames: frame released more times than retained")
+	}
+}
+
+// TrySend sends the frame on a channel without blocking, taking a reference for the receiver if it was sent.
+func (f *Frame) TrySend(send chan<- *Frame) bool {
+	f.Retain()
+	select {
+	case send <- f:
+		return true
+	default:
+		f.Release()
+		return false
+	}
+}
@@ -0,0 +1,51 @@
+package frames_test
+
+import (
+	"testing"
+
+	"go-chat-app/frames"
+)
+
+func TestMarshal(t *testing.T) {
+	f, err := frames.Marshal(map[string]string{"content": "<b>hi</b>"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Release()
+
+	if got := string(f.Bytes()); got != `{"content":"<b>hi</b>"}` {
+		t.Errorf("unexpected frame %s", got)
+	}
+}
+
+func TestTrySend(t *testing.T) {
+	f, _ := frames.Marshal("hello")
+	defer f.Release()
+
+	full := make(chan *frames.Frame)
+	if f.TrySend(full) {
+		t.Fatal("expected send to a blocked channel to fail")
+	}
+
+	queue := make(chan *frames.Frame, 1)
+	if !f.TrySend(queue) {
+		t.Fatal("expected send to a buffered channel to succeed")
+	}
+	received := <-queue
+	if string(received.Bytes()) != `"hello"` {
+		t.Errorf("unexpected frame %s", received.Bytes())
+	}
+	received.Release()
+}
+
+func TestRelease_PanicsWhenOverReleased(t *testing.T) {
+	f, _ := frames.Marshal("hello")
+	f.Release()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic releasing a frame twice")
+		}
+	}()
+	f.Release()
+}
@@ -0,0 +1,62 @@
+package guests
+
+import (
+	"errors"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+
+	"go-chat-app/db"
+	"go-chat-app/models"
+	"go-chat-app/usernames"
+	"go-chat-app/utils"
+)
+
+// Guests can join the chat without an account when ALLOW_GUESTS is set. Each guest connection is given a generated
+// display name such as "Anonymous-1234" that isn't used by anyone active in the tenant or by a registered user, and
+// registering names of that form is blocked, so guests and registered users can't be mistaken for each other.
+
+// Config holds the guest access settings.
+type Config struct {
+	Enabled bool
+	Prefix  string // Guest names are the prefix, a dash and a number
+}
+
+// Guest names start with 4 digit numbers, moving on to longer ones if a tenant has too many guests to find a free one
+const attemptsPerLength = 20
+
+// ErrNoGuestName is returned if no free guest name could be found.
+var ErrNoGuestName = errors.New("no free guest name")
+
+// LoadConfig reads ALLOW_GUESTS and GUEST_NAME_PREFIX (default Anonymous) from the environment.
+func LoadConfig() *Config {
+	enabled, _ := strconv.ParseBool(os.Getenv("ALLOW_GUESTS"))
+	prefix := strings.TrimSpace(os.Getenv("GUEST_NAME_PREFIX"))
+	if prefix == "" {
+		prefix = "Anonymous"
+	}
+	return &Config{Enabled: enabled, Prefix: prefix}
+}
+
+// NewGuest creates a guest user in a tenant with a unique generated name.
+func (c *Config) NewGuest(tenantID int, database db.DBInterface) (*models.User, error) {
+	active := make(map[string]bool)
+	for _, name := range utils.CollectActiveUsers()[tenantID] {
+		active[usernames.Key(name)] = true
+	}
+
+	for low, high := 1000, 10000; high <= 100000000; low, high = high, high*100 {
+		for range attemptsPerLength {
+			name := usernames.GuestName(c.Prefix, low+rand.IntN(high-low))
+			if active[usernames.Key(name)] {
+				continue
+			}
+			if _, err := database.GetUserByUsername(tenantID, name); err == nil {
+				continue // Registered before guest names were reserved
+			}
+			return &models.User{TenantID: tenantID, Username: name, IsGuest: true}, nil
+		}
+	}
+	return nil, ErrNoGuestName
+}
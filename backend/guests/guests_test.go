@@ -0,0 +1,37 @@
+package guests_test
+
+import (
+	"strings"
+	"testing"
+
+	"go-chat-app/db"
+	"go-chat-app/guests"
+	"go-chat-app/usernames"
+)
+
+func TestNewGuest(t *testing.T) {
+	config := &guests.Config{Enabled: true, Prefix: "Guest"}
+
+	guest, err := config.NewGuest(1, db.NewMockDB())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !guest.IsGuest || guest.TenantID != 1 || guest.ID != 0 {
+		t.Errorf("expected a guest in tenant 1 with no ID, got %+v", guest)
+	}
+	if !strings.HasPrefix(guest.Username, "Guest-") || !usernames.IsGuestName("Guest", guest.Username) {
+		t.Errorf("expected a generated guest name, got %q", guest.Username)
+	}
+}
+
+func TestGuestNamesAreReserved(t *testing.T) {
+	rules := usernames.DefaultRules()
+	rules.GuestPrefix = "Anonymous"
+
+	if _, ok := rules.Validate("anonymous-1234"); ok {
+		t.Error("expected guest style names to be reserved")
+	}
+	if _, ok := rules.Validate("anonymous-fan"); !ok {
+		t.Error("expected names that only share the prefix to be allowed")
+	}
+}
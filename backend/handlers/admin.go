@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"go-chat-app/apierror"
+	"go-chat-app/auth"
+	"go-chat-app/featureflags"
+	"go-chat-app/models"
+	"go-chat-app/services"
+	"go-chat-app/utils"
+	"go-chat-app/validation"
+
+	"github.com/gorilla/websocket"
+)
+
+// Admin handlers for tenant admins. Admins can only see and manage their own tenant.
+
+// maxMOTDLength limits the length of the message of the day
+const maxMOTDLength = 2000
+
+// authoriseAdmin authorises an admin request, writing the error response and returning false if it fails.
+func authoriseAdmin(services *services.Services, w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user, err := services.Auth.AuthoriseAdmin(r)
+	if errors.Is(err, auth.ErrNotAdmin) {
+		apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Admin role required")
+		return nil, false
+	}
+	if err != nil {
+		apierror.Unauthorised(w)
+		return nil, false
+	}
+	return user, true
+}
+
+// AdminConnectionsHandler handles GET requests listing the tenant's active WebSocket connections.
+func AdminConnectionsHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		admin, ok := authoriseAdmin(services, w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(utils.CollectConnections(admin.TenantID, services.Clock.Now()))
+	}
+}
+
+// AdminConnectionHandler handles DELETE requests force closing a WebSocket connection.
+func AdminConnectionHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		admin, ok := authoriseAdmin(services, w, r)
+		if !ok {
+			return
+		}
+
+		client, found := utils.GetClientByID(r.PathValue("id"))
+		if !found || client.TenantID != admin.TenantID {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "Connection not found")
+			return
+		}
+
+		// Closing the connection ends the client's read loop, which deregisters it
+		log.Printf("Admin %s force closed connection %s for user %s", admin.Username, client.ID, client.DisplayName)
+		advice := services.Backoff.Recommend(utils.CountClients())
+		utils.CloseClient(client, websocket.CloseTryAgainLater, advice.CloseReason("Closed by an admin"))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// AdminMOTDHandler handles PUT requests setting the tenant's message of the day and DELETE requests clearing it.
+func AdminMOTDHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin, ok := authoriseAdmin(services, w, r)
+		if !ok {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			v, err := validation.New(r)
+			if err != nil {
+				validation.WriteBodyError(w, err)
+				return
+			}
+
+			message := strings.TrimSpace(v.Get("message"))
+			v.Required("message")
+			v.Check(len(message) <= maxMOTDLength, "message", fmt.Sprintf("must be at most %d characters", maxMOTDLength))
+			if !v.Valid() {
+				v.WriteError(w, http.StatusBadRequest)
+				return
+			}
+
+			if err := services.DB.SetMOTD(admin.TenantID, message, admin.Username); err != nil {
+				log.Printf("Failed to set message of the day: %v", err)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to set message of the day")
+				return
+			}
+			log.Printf("Admin %s set the message of the day", admin.Username)
+			w.WriteHeader(http.StatusNoContent)
+
+		case http.MethodDelete:
+			if err := services.DB.ClearMOTD(admin.TenantID); err != nil {
+				log.Printf("Failed to clear message of the day: %v", err)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to clear message of the day")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			apierror.MethodNotAllowed(w)
+		}
+	}
+}
+
+// AdminUserDeactivationHandler handles PUT requests deactivating a user's account and DELETE requests reactivating it.
+// Deactivated users can't log in and are disconnected, but their messages stay attributed to them.
+func AdminUserDeactivationHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		admin, ok := authoriseAdmin(services, w, r)
+		if !ok {
+			return
+		}
+
+		user, err := services.DB.GetUserByUsername(admin.TenantID, r.PathValue("username"))
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "User not found")
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			if user.ID == admin.ID {
+				apierror.Write(w, http.StatusConflict, apierror.CodeConflict, "Admins can't deactivate their own account here")
+				return
+			}
+			if err := services.DB.DeactivateUser(user.ID, services.Clock.Now()); err != nil {
+				log.Printf("Failed to deactivate user %s: %v", user.Username, err)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to deactivate user")
+				return
+			}
+			utils.CloseUserConnections(user.TenantID, user.ID, "Account deactivated")
+			log.Printf("Admin %s deactivated user %s", admin.Username, user.Username)
+		} else {
+			if err := services.DB.ReactivateUser(user.ID); err != nil {
+				log.Printf("Failed to reactivate user %s: %v", user.Username, err)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to reactivate user")
+				return
+			}
+			log.Printf("Admin %s reactivated user %s", admin.Username, user.Username)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// featureFlagUpdate is the body of a request changing a tenant's setting for a feature flag.
+type featureFlagUpdate struct {
+	Enabled    bool     `json:"enabled"`
+	Percentage *int     `json:"percentage"` // Defaults to 100
+	Users      []string `json:"users"`      // Usernames the flag is always on for
+}
+
+// AdminFeatureFlagsHandler handles GET requests listing the tenant's feature flags, including those left at the
+// instance default.
+func AdminFeatureFlagsHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		admin, ok := authoriseAdmin(services, w, r)
+		if !ok {
+			return
+		}
+
+		flags, err := services.Flags.List(admin.TenantID)
+		if err != nil {
+			log.Printf("Failed to list feature flags: %v", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list feature flags")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(flags)
+	}
+}
+
+// AdminFeatureFlagHandler handles PUT requests setting a feature flag for the tenant and DELETE requests resetting it
+// to the instance default. Changes apply on this instance straight away and on others once their cache expires.
+func AdminFeatureFlagHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut && r.Method != http.MethodDelete {
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		admin, ok := authoriseAdmin(services, w, r)
+		if !ok {
+			return
+		}
+
+		name := r.PathValue("name")
+		if !featureflags.Known(name) {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "Feature flag not found")
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			if err := services.DB.DeleteFeatureFlag(admin.TenantID, name); err != nil {
+				log.Printf("Failed to reset feature flag %s: %v", name, err)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to reset feature flag")
+				return
+			}
+			services.Flags.Invalidate(admin.TenantID)
+			log.Printf("Admin %s reset feature flag %s to the default", admin.Username, name)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		var update featureFlagUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			validation.WriteBodyError(w, err)
+			return
+		}
+
+		flag := models.FeatureFlag{Name: name, Enabled: update.Enabled, Percentage: 100, Users: []string{}, UpdatedBy: admin.Username}
+		if update.Percentage != nil {
+			flag.Percentage = *update.Percentage
+		}
+		errs := featureflags.Validate(flag)
+		for i, username := range update.Users {
+			user, err := services.DB.GetUserByUsername(admin.TenantID, username)
+			if err != nil {
+				errs = append(errs, validation.FieldError{Field: fmt.Sprintf("users[%d]", i), Message: "must be a member of the tenant"})
+				continue
+			}
+			flag.UserIDs = append(flag.UserIDs, user.ID)
+			flag.Users = append(flag.Users, user.Username)
+		}
+		if len(errs) > 0 {
+			apierror.WriteDetails(w, http.StatusBadRequest, apierror.CodeValidationFailed, "Validation failed", errs)
+			return
+		}
+
+		if err := services.DB.SetFeatureFlag(admin.TenantID, flag); err != nil {
+			log.Printf("Failed to set feature flag %s: %v", name, err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to set feature flag")
+			return
+		}
+		services.Flags.Invalidate(admin.TenantID)
+		flag.UpdatedAt = services.Clock.Now()
+		log.Printf("Admin %s set feature flag %s: enabled %t for %d%% of users and %d listed users", admin.Username, name, flag.Enabled, flag.Percentage, len(flag.UserIDs))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(flag)
+	}
+}
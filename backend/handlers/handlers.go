@@ -1,36 +1,92 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"go-chat-app/analytics"
+	"go-chat-app/apierror"
+	"go-chat-app/archive"
 	"go-chat-app/broadcast"
+	"go-chat-app/chaos"
+	"go-chat-app/db"
+	"go-chat-app/featureflags"
+	"go-chat-app/flood"
+	"go-chat-app/frames"
+	"go-chat-app/highlight"
 	"go-chat-app/models"
+	"go-chat-app/protocol"
 	"go-chat-app/services"
+	"go-chat-app/tenants"
+	"go-chat-app/tracing"
 	"go-chat-app/utils"
+	"go-chat-app/validation"
 
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // WebSocket handlers focuses on establishing connections and adding clients to the user pool.
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow any origin. Todo: adjust in production for security.
-		return true
-	},
-}
+// How often a connected user's last seen time is updated
+const lastSeenInterval = time.Minute
+
+// maxBatchFrames limits how many queued frames are coalesced into one WebSocket message
+const maxBatchFrames = 32
+
+// Locales that normally write times with a 12 hour clock, all others get a 24 hour clock
+var twelveHourLocales = map[string]bool{"en-US": true, "en-CA": true, "en-AU": true, "en-NZ": true, "en-IN": true, "en-PH": true}
+
+// Reactions are limited to what a single emoji sequence can reasonably be, such as a family or flag
+const (
+	maxReactionRunes = 8
+	maxReactionBytes = 64 // Matches the emoji column size
+)
 
 // HandleConnections handles when a user connects. It authenticates, upgrades the HTTP connection to a WebSocket connection,
 // adds the user to the client map, starts listening for messages from the client, and reads incoming websocket messages
 func HandleConnections(services *services.Services) http.HandlerFunc {
+	upgrader := websocket.Upgrader{
+		CheckOrigin:       services.Origins.CheckWebSocketOrigin, // Same origin policy as CORS
+		EnableCompression: true,                                  // Only used for clients that agree to compression in their hello frame
+	}
+
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Authenticate the user
+		// Authenticate the user, or let them join as a guest if guests are allowed
 		user, err := services.Auth.Authorise(r)
+		if err != nil && services.Guests.Enabled {
+			user, err = services.Guests.NewGuest(tenants.IDFromContext(r.Context()), services.DB)
+		}
 		if err != nil {
 			log.Printf("Unauthorised WebSocket connection attempt: %v", err)
-			http.Error(w, "Unauthorised", http.StatusUnauthorized)
+			apierror.Unauthorised(w)
+			return
+		}
+
+		// Embedded widgets must present a valid embed key for the site they are embedded on
+		if err := services.Embed.ValidateHandshake(r); err != nil {
+			log.Printf("Rejected embedded WebSocket connection for user %s: %v", user.Username, err)
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Embed key rejected")
+			return
+		}
+
+		// Turn connections away when at capacity, telling the client how long to back off for
+		if connections := utils.CountClients(); services.Backoff.Full(connections) {
+			log.Printf("Rejected WebSocket connection for user %s: at capacity with %d connections", user.Username, connections)
+			w.Header().Set("Retry-After", services.Backoff.Recommend(connections).Seconds())
+			apierror.Write(w, http.StatusServiceUnavailable, apierror.CodeServerBusy, "Server is at capacity, try again later")
 			return
 		}
 
@@ -38,70 +94,600 @@ func HandleConnections(services *services.Services) http.HandlerFunc {
 		log.Printf("WebSocket connection authorised for user: %s", user.Username)
 
 		// Upgrade the HTTP connection to WebSocket.
-		ws, err := upgrader.Upgrade(w, r, nil)
+		// The response header rehomes the user here if they were homed on another instance
+		ws, err := upgrader.Upgrade(w, r, services.Affinity.ResponseHeader(r))
 		if err != nil {
 			log.Printf("WebSocket upgrade error: %v", err)
 			return
 		}
 		defer ws.Close()
+		ws.EnableWriteCompression(false)
 
 		// Create a new Client instance and adds it to the clients map
-		client := utils.MakeClient(r, ws, user)
-		utils.RegisterClient(client)
+		client := utils.MakeClient(r, ws, user, services.IDs.NewID(), services.Clock.Now())
 
 		// Start listening for messages from this client
 		go handleClientMessages(client)
 
-		// Read incoming websocket messages
+		// The message of the day is sent before registering so it is always the first frame
+		sendMOTD(services, client)
+		utils.RegisterClient(client)
+
+		// There's a single chat per tenant, so connecting to it is joining its room
+		services.Analytics.Track(analytics.RoomJoined, client.TenantID, user.ID, map[string]any{"guest": user.IsGuest})
+
+		// Keep the user's last seen time up to date while they are connected. Guests have no account to update
+		stopHeartbeat := make(chan struct{})
+		if !user.IsGuest {
+			go lastSeenHeartbeat(services, user.ID, stopHeartbeat)
+		}
+
+		// Read incoming websocket messages, dropping frames over the connection's rate limit
+		limiter := services.Flood.NewLimiter()
 		for {
-			var msg models.Message
-			err := ws.ReadJSON(&msg)
+			_, data, err := ws.ReadMessage()
 			if err != nil {
 				log.Printf("WebSocket read error: %v", err)
 				utils.DeregisterClient(client)
 				break
 			}
-			broadcast.BroadcastMessage(msg)
+
+			action := limiter.Check(services.Clock.Now())
+			if action == flood.Disconnect {
+				log.Printf("Disconnecting client %s for flooding", client.ID)
+				advice := services.Backoff.Recommend(utils.CountClients())
+				closeMessage := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, advice.CloseReason("Message rate exceeded"))
+				ws.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+				utils.DeregisterClient(client)
+				break
+			}
+			if action == flood.Allow {
+				client.RecordActivity(services.Clock.Now())
+				handleFrame(services, client, data)
+			} else {
+				handleFlood(services, client, action)
+			}
+		}
+
+		close(stopHeartbeat)
+		if !user.IsGuest {
+			recordLastSeen(services, user.ID)
+		}
+	}
+}
+
+// handleFlood tells a client over its rate limit that its frame was dropped.
+func handleFlood(services *services.Services, client *models.Client, action flood.Action) {
+	switch action {
+	case flood.Warn:
+		sendNotice(services, client, "rate_limited", "You're sending messages too quickly, some were not sent")
+	case flood.Mute:
+		log.Printf("Muting client %s for flooding", client.ID)
+		until := formatClock(client, services.Clock.Now().Add(flood.MuteDuration))
+		sendNotice(services, client, "muted", fmt.Sprintf("You've been muted until %s for sending messages too quickly", until))
+	}
+}
+
+// formatClock formats a time of day in the client's time zone, using a 12 hour clock for locales that expect one.
+func formatClock(client *models.Client, t time.Time) string {
+	t = t.In(client.Location())
+	if twelveHourLocales[client.Capabilities().Locale] {
+		return t.Format("3:04:05 PM")
+	}
+	return t.Format("15:04:05")
+}
+
+// sendNotice sends a system notice to a client without waiting if its queue is full.
+func sendNotice(services *services.Services, client *models.Client, code, content string) {
+	frame, err := frames.Marshal(models.Notice{
+		Type:      protocol.TypeNotice,
+		Code:      code,
+		Sender:    "System",
+		Content:   content,
+		Timestamp: services.Clock.Now(),
+	})
+	if err != nil {
+		return
+	}
+	frame.TrySend(client.Send)
+	frame.Release()
+}
+
+// sendMOTD sends the tenant's message of the day to a client, if one is set.
+func sendMOTD(services *services.Services, client *models.Client) {
+	motd, err := services.DB.GetMOTD(client.TenantID)
+	if err != nil {
+		log.Printf("Failed to get message of the day: %v", err)
+		return
+	}
+	if motd.Content == "" {
+		return
+	}
+
+	if frame, err := frames.Marshal(motd); err == nil {
+		client.Send <- frame
+	}
+}
+
+// lastSeenHeartbeat periodically records that a connected user was seen, until stopped when they disconnect.
+func lastSeenHeartbeat(services *services.Services, userID int, stop <-chan struct{}) {
+	defer utils.Recover("last seen heartbeat for user %d", userID)
+	recordLastSeen(services, userID)
+
+	ticker := time.NewTicker(lastSeenInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			recordLastSeen(services, userID)
+		}
+	}
+}
+
+func recordLastSeen(services *services.Services, userID int) {
+	if err := services.DB.UpdateLastSeen(userID, services.Clock.Now()); err != nil {
+		log.Printf("Failed to record last seen: %v", err)
+	}
+}
+
+// handleFrame handles a frame received from a client based on its type.
+func handleFrame(services *services.Services, client *models.Client, data []byte) {
+	// A frame that makes its handler panic is dropped, keeping the connection open
+	defer utils.Recover("handling a frame from client %s", client.ID)
+
+	ctx, span := tracing.Tracer().Start(context.Background(), "websocket.intake",
+		trace.WithAttributes(attribute.String("chat.client_id", client.ID), attribute.Int("chat.tenant_id", client.TenantID)))
+	defer span.End()
+
+	var frame protocol.Frame
+	if err := json.Unmarshal(data, &frame); err != nil {
+		log.Printf("Invalid frame from client %s: %v", client.ID, err)
+		span.SetStatus(codes.Error, "invalid frame")
+		return
+	}
+	span.SetAttributes(attribute.String("chat.frame_type", frame.Type))
+
+	switch frame.Type {
+	case protocol.TypeHello:
+		var hello protocol.Hello
+		if err := json.Unmarshal(data, &hello); err != nil {
+			log.Printf("Invalid hello frame from client %s: %v", client.ID, err)
+			return
+		}
+
+		capabilities := protocol.Negotiate(hello)
+		client.SetCapabilities(capabilities)
+
+		if welcome, err := frames.Marshal(capabilities); err == nil {
+			client.Send <- welcome
+		}
+
+	case "", protocol.TypeChat:
+		var msg models.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Printf("Invalid chat message from client %s: %v", client.ID, err)
+			return
+		}
+		msg.ID = services.MessageIDs.Next()
+		msg.TenantID = client.TenantID
+		msg.Sender = client.DisplayName                      // Never trust the client's claimed sender, so no one can impersonate another user
+		msg.Type, msg.Language, msg.Highlighted = "", "", "" // Only set by the server for code snippets
+		msg.Verified = false                                 // Only set for signed webhook messages
+		client.RecordMessage(services.Clock.Now())
+		broadcast.BroadcastMessage(ctx, msg)
+		trackMessageSent(services, client, msg)
+
+	case protocol.TypeCode:
+		var msg models.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			log.Printf("Invalid code message from client %s: %v", client.ID, err)
+			return
+		}
+
+		// Highlight once here so every client renders the snippet the same way, keeping the raw source for copying
+		highlighted, language, err := highlight.Code(msg.Language, msg.Content)
+		if err != nil {
+			log.Printf("Failed to highlight code from client %s: %v", client.ID, err)
+			span.SetStatus(codes.Error, "highlight failed")
+			return
+		}
+		msg.ID = services.MessageIDs.Next()
+		msg.TenantID = client.TenantID
+		msg.Sender = client.DisplayName
+		msg.Type = protocol.TypeCode
+		msg.Language = language
+		msg.Highlighted = highlighted
+		msg.Verified = false
+		client.RecordMessage(services.Clock.Now())
+		broadcast.BroadcastMessage(ctx, msg)
+		trackMessageSent(services, client, msg)
+
+	case protocol.TypeReaction:
+		var toggle models.ReactionToggle
+		if err := json.Unmarshal(data, &toggle); err != nil {
+			log.Printf("Invalid reaction from client %s: %v", client.ID, err)
+			return
+		}
+		if client.UserID == 0 {
+			sendNotice(services, client, "reaction_rejected", "Guests can't react to messages")
+			return
+		}
+		if !services.Flags.Enabled(client.TenantID, client.UserID, featureflags.Reactions) {
+			sendNotice(services, client, "reaction_rejected", "Reactions aren't available yet")
+			return
+		}
+		if !validReaction(toggle.Emoji) {
+			sendNotice(services, client, "reaction_rejected", "Reactions must be a single emoji")
+			return
+		}
+
+		err := broadcast.ToggleReaction(ctx, client.TenantID, client.UserID, client.DisplayName, toggle.MessageID, toggle.Emoji)
+		if errors.Is(err, db.ErrMessageNotFound) {
+			sendNotice(services, client, "reaction_rejected", "That message doesn't exist")
+		} else if err != nil {
+			log.Printf("Failed to toggle reaction for client %s: %v", client.ID, err)
+			span.SetStatus(codes.Error, "reaction failed")
+		}
+
+	default:
+		log.Printf("Unknown frame type %q from client %s", frame.Type, client.ID)
+	}
+}
+
+// trackMessageSent records a message in product analytics. Only its shape is recorded, never its content.
+func trackMessageSent(services *services.Services, client *models.Client, msg models.Message) {
+	messageType := msg.Type
+	if messageType == "" {
+		messageType = protocol.TypeChat
+	}
+	services.Analytics.Track(analytics.MessageSent, client.TenantID, client.UserID, map[string]any{
+		"type":   messageType,
+		"length": utf8.RuneCountInString(msg.Content),
+		"guest":  client.UserID == 0,
+		"source": "websocket",
+	})
+}
+
+// validReaction checks a reaction is a short emoji-like string, not arbitrary text.
+// Emojis can be several code points (skin tones, flags, ZWJ sequences), so only the length and characters are limited.
+func validReaction(emoji string) bool {
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxReactionRunes || len(emoji) > maxReactionBytes {
+		return false
+	}
+	for _, r := range emoji {
+		if r < utf8.RuneSelf || unicode.IsSpace(r) || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return false
 		}
 	}
+	return true
 }
 
 // handleClientMessages goroutine listening for messages from this client
 func handleClientMessages(client *models.Client) {
+	// A panic closes the connection, so the read loop ends too, rather than crashing the process
+	defer func() {
+		if p := recover(); p != nil {
+			utils.LogPanic(p, "writer for client %s", client.ID)
+			client.Conn.Close()
+		}
+	}()
 	defer utils.DeregisterClient(client)
 	for {
-		msg := <-client.Send
-		if err := client.Conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+		frame := <-client.Send
+		if err := writeFrames(client, frame); err != nil {
 			log.Println("write error:", err)
 			return
 		}
 	}
 }
 
+// writeFrames writes a frame to the client. Clients that agreed to batching also get any frames queued behind it in
+// the same WebSocket message, separated by newlines, so a backlog is cleared with one write instead of one per frame.
+func writeFrames(client *models.Client, frame *frames.Frame) error {
+	if !sendAfterChaos(client, frame) {
+		return nil
+	}
+
+	// Only compress once agreed in the hello frame. Set here as the connection only allows one writer at a time.
+	capabilities := client.Capabilities()
+	client.Conn.EnableWriteCompression(capabilities.Compression != "")
+	w, err := client.Conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		frame.Release()
+		return err
+	}
+	_, err = w.Write(frame.Bytes())
+	frame.Release()
+
+	if capabilities.Batching == protocol.BatchingNDJSON {
+		for queued := min(len(client.Send), maxBatchFrames-1); queued > 0 && err == nil; queued-- {
+			next := <-client.Send
+			if !sendAfterChaos(client, next) {
+				continue
+			}
+			if _, err = w.Write([]byte{'\n'}); err == nil {
+				_, err = w.Write(next.Bytes())
+			}
+			next.Release()
+		}
+	}
+
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// sendAfterChaos applies chaos mode to an outbound frame, releasing it and returning false if it should not be sent.
+func sendAfterChaos(client *models.Client, frame *frames.Frame) bool {
+	switch chaos.BeforeSend() {
+	case chaos.Drop:
+		frame.Release()
+		return false
+	case chaos.Disconnect:
+		log.Printf("Chaos mode: disconnecting client %s", client.ID)
+		frame.Release()
+		client.Conn.Close()
+		return false
+	}
+	return true
+}
+
 // ChatHistoryHandler handles GET or DELETE requests for the chat history endpoint.
 // Todo: Add paging and offsets
 func ChatHistoryHandler(services *services.Services) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
-			messages, err := services.DB.GetChatHistory()
+			tenantID := tenants.IDFromContext(r.Context())
+			messages, err := services.DB.GetChatHistory(tenantID)
 			if err != nil {
-				http.Error(w, "Failed to retrieve chat history", http.StatusInternalServerError)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve chat history")
+				return
+			}
+			if err := hydrateReactions(services, tenantID, messages); err != nil {
+				log.Printf("Failed to get reactions: %v", err)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve chat history")
+				return
+			}
+
+			body, err := json.Marshal(messages)
+			if err != nil {
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve chat history")
+				return
+			}
+
+			// Tagged by the newest message, plus a hash of the page so reactions and deletions change the tag too
+			newestID := 0
+			if len(messages) > 0 {
+				newestID = messages[len(messages)-1].ID
+			}
+			hash := fnv.New64a()
+			hash.Write(body)
+			etag := fmt.Sprintf(`W/"m%d-%x"`, newestID, hash.Sum64())
+
+			w.Header().Set("ETag", etag)
+			if etagMatches(r, etag) {
+				w.WriteHeader(http.StatusNotModified)
 				return
 			}
 			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(messages)
+			w.Write(append(body, '\n'))
 
 		case http.MethodDelete:
-			err := services.DB.DeleteAllMessages()
+			err := services.DB.DeleteAllMessages(tenants.IDFromContext(r.Context()))
 			if err != nil {
-				http.Error(w, "Failed to delete messages", http.StatusInternalServerError)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete messages")
 				return
 			}
 			w.WriteHeader(http.StatusNoContent)
 
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			apierror.MethodNotAllowed(w)
+		}
+	}
+}
+
+// hydrateReactions fills in the reactions to a page of messages with one query.
+// History isn't per user, so reactions are left out only when the flag is off for the whole tenant.
+func hydrateReactions(services *services.Services, tenantID int, messages []models.Message) error {
+	if !services.Flags.Get(tenantID, featureflags.Reactions).Enabled {
+		return nil
+	}
+
+	ids := make([]int, 0, len(messages))
+	for _, msg := range messages {
+		ids = append(ids, msg.ID)
+	}
+
+	reactions, err := services.DB.GetReactions(tenantID, ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Reactions = reactions[messages[i].ID]
+	}
+	return nil
+}
+
+// etagMatches reports whether a request's If-None-Match header matches an ETag, so a 304 can be sent instead.
+// Tags are compared weakly, as compression can change the bytes sent for the same page.
+func etagMatches(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// MOTDHandler handles GET requests for the tenant's message of the day.
+func MOTDHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		motd, err := services.DB.GetMOTD(tenants.IDFromContext(r.Context()))
+		if err != nil {
+			log.Printf("Failed to get message of the day: %v", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get message of the day")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(motd)
+	}
+}
+
+// ArchivesHandler handles GET requests listing the pages of old messages moved to cold storage.
+func ArchivesHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		archives, err := services.DB.GetMessageArchives(tenants.IDFromContext(r.Context()))
+		if err != nil {
+			log.Printf("Failed to get message archives: %v", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve archived history")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(archives)
+	}
+}
+
+// ArchivePageHandler handles GET requests for a page of archived messages, fetched from cold storage on demand.
+// The response has the same format as the live chat history.
+func ArchivePageHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		archiveID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid archive id")
+			return
+		}
+
+		page, err := services.DB.GetMessageArchive(tenants.IDFromContext(r.Context()), archiveID)
+		if err != nil || services.Archive == nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "Archive not found")
+			return
+		}
+
+		// Archived pages never change, so clients that have a page don't need it fetched from cold storage again
+		etag := fmt.Sprintf(`W/"a%d-%d"`, page.ID, page.LastMessageID)
+		w.Header().Set("ETag", etag)
+		if etagMatches(r, etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		messages, err := archive.FetchPage(r.Context(), services.Archive, page)
+		if err != nil {
+			log.Printf("Failed to fetch archive %d: %v", archiveID, err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve archived history")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(messages)
+	}
+}
+
+// EventsHandler handles GET requests listing upcoming events and POST requests scheduling a new one.
+// New events take a title and a starts_at time in RFC 3339 format.
+func EventsHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := services.Auth.Authorise(r)
+		if err != nil {
+			apierror.Unauthorised(w)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			events, err := services.DB.GetUpcomingEvents(user.TenantID)
+			if err != nil {
+				log.Printf("Failed to get events: %v", err)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to retrieve events")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(events)
+
+		case http.MethodPost:
+			v, err := validation.New(r)
+			if err != nil {
+				validation.WriteBodyError(w, err)
+				return
+			}
+
+			title := strings.TrimSpace(v.Get("title"))
+			v.Required("title")
+			startsAt, err := time.Parse(time.RFC3339, v.Get("starts_at"))
+			v.Check(err == nil, "starts_at", "must be a time in RFC 3339 format")
+			v.Check(err != nil || startsAt.After(services.Clock.Now()), "starts_at", "must be in the future")
+			if !v.Valid() {
+				v.WriteError(w, http.StatusBadRequest)
+				return
+			}
+
+			event := models.Event{
+				TenantID:  user.TenantID,
+				Title:     title,
+				StartsAt:  startsAt.UTC(),
+				CreatedBy: user.Username,
+			}
+			event.ID, err = services.DB.SaveEvent(event)
+			if err != nil {
+				log.Printf("Failed to save event: %v", err)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save event")
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(event)
+
+		default:
+			apierror.MethodNotAllowed(w)
+		}
+	}
+}
+
+// CancelEventHandler handles DELETE requests cancelling a scheduled event.
+func CancelEventHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		user, err := services.Auth.Authorise(r)
+		if err != nil {
+			apierror.Unauthorised(w)
+			return
+		}
+
+		eventID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid event id")
+			return
+		}
+
+		if err := services.DB.CancelEvent(user.TenantID, eventID); err != nil {
+			log.Printf("Failed to cancel event %d: %v", eventID, err)
+			apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "Event not found")
+			return
 		}
+		w.WriteHeader(http.StatusNoContent)
 	}
 }
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"go-chat-app/apierror"
+	"go-chat-app/mailer"
+	"go-chat-app/services"
+	"go-chat-app/transcript"
+	"go-chat-app/validation"
+)
+
+// Transcript recipients
+const (
+	recipientMe         = "me"         // The requesting user's email address
+	recipientCompliance = "compliance" // The configured compliance address, admins only
+)
+
+// TranscriptHandler handles POST requests emailing the transcript of a day's chat. Takes a date as YYYY-MM-DD, which
+// is the day in the user's time zone, and a recipient of "me" (the default) or "compliance".
+func TranscriptHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		user, err := services.Auth.Authorise(r)
+		if err != nil {
+			apierror.Unauthorised(w)
+			return
+		}
+
+		if services.Mailer == nil {
+			apierror.Write(w, http.StatusServiceUnavailable, apierror.CodeInternal, "Email isn't configured")
+			return
+		}
+
+		v, err := validation.New(r)
+		if err != nil {
+			validation.WriteBodyError(w, err)
+			return
+		}
+
+		// Dates are in the user's own time zone so the transcript matches the day they saw
+		location := time.UTC
+		if prefs, ok, err := services.DB.GetPreferences(user.ID); err == nil && ok {
+			if loaded, err := time.LoadLocation(prefs.TimeZone); err == nil {
+				location = loaded
+			}
+		}
+
+		date, err := time.ParseInLocation(time.DateOnly, v.Get("date"), location)
+		v.Required("date")
+		v.Check(err == nil, "date", "must be a date as YYYY-MM-DD")
+
+		recipient := v.Get("recipient")
+		if recipient == "" {
+			recipient = recipientMe
+		}
+		to := ""
+		switch recipient {
+		case recipientMe:
+			to = user.Email
+			v.Check(to != "", "recipient", "set an email address before requesting a transcript")
+		case recipientCompliance:
+			to = services.ComplianceEmail
+			v.Check(user.IsAdmin, "recipient", "only admins can send transcripts to the compliance address")
+			v.Check(to != "", "recipient", "no compliance address is configured")
+		default:
+			v.Check(false, "recipient", `must be "me" or "compliance"`)
+		}
+		if !v.Valid() {
+			v.WriteError(w, http.StatusBadRequest)
+			return
+		}
+
+		from, until := transcript.Day(date)
+		messages, err := transcript.Messages(r.Context(), services.DB, services.Archive, user.TenantID, from, until)
+		if err != nil {
+			log.Printf("Failed to compile transcript: %v", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to compile transcript")
+			return
+		}
+
+		title := fmt.Sprintf("Chat transcript for %s", date.Format("Monday 2 January 2006"))
+		html, err := transcript.Render(title, messages, location)
+		if err != nil {
+			log.Printf("Failed to render transcript: %v", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to compile transcript")
+			return
+		}
+
+		if err := services.Mailer.Send(r.Context(), mailer.Mail{To: []string{to}, Subject: title, HTML: html}); err != nil {
+			log.Printf("Failed to email transcript: %v", err)
+			apierror.Write(w, http.StatusBadGateway, apierror.CodeInternal, "Failed to send transcript")
+			return
+		}
+		log.Printf("User %s emailed the %s transcript to %s", user.Username, date.Format(time.DateOnly), recipient)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
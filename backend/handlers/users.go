@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+
+	"go-chat-app/apierror"
+	"go-chat-app/models"
+	"go-chat-app/preferences"
+	"go-chat-app/services"
+	"go-chat-app/tenants"
+	"go-chat-app/usernames"
+	"go-chat-app/utils"
+	"go-chat-app/validation"
+)
+
+// maxPreferencesBytes limits the size of a preferences update
+const maxPreferencesBytes = 64 << 10
+
+// UserHandler handles GET requests for a user's presence: whether they are online and when they were last seen.
+func UserHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		viewer, err := services.Auth.Authorise(r)
+		if err != nil {
+			apierror.Unauthorised(w)
+			return
+		}
+
+		user, err := services.DB.GetUserByUsername(viewer.TenantID, r.PathValue("username"))
+		if err != nil {
+			apierror.Write(w, http.StatusNotFound, apierror.CodeNotFound, "User not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(models.UserStatus{
+			Username:    user.Username,
+			Online:      utils.IsUserOnline(user.TenantID, user.ID),
+			LastSeenAt:  user.LastSeenAt,
+			Deactivated: user.DeactivatedAt != nil,
+		})
+	}
+}
+
+// PreferencesHandler handles GET requests for the user's own preferences and PUT requests replacing them.
+func PreferencesHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := services.Auth.Authorise(r)
+		if err != nil {
+			apierror.Unauthorised(w)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			prefs, ok, err := services.DB.GetPreferences(user.ID)
+			if err != nil {
+				log.Printf("Failed to get preferences: %v", err)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get preferences")
+				return
+			}
+			if !ok {
+				prefs = preferences.Default()
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(prefs)
+
+		case http.MethodPut:
+			prefs := preferences.Default()
+			if err := json.NewDecoder(io.LimitReader(r.Body, maxPreferencesBytes)).Decode(&prefs); err != nil {
+				validation.WriteBodyError(w, err)
+				return
+			}
+			if errs := preferences.Validate(prefs); len(errs) > 0 {
+				apierror.WriteDetails(w, http.StatusBadRequest, apierror.CodeValidationFailed, "Validation failed", errs)
+				return
+			}
+
+			if err := services.DB.SavePreferences(user.ID, prefs); err != nil {
+				log.Printf("Failed to save preferences: %v", err)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save preferences")
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(prefs)
+
+		default:
+			apierror.MethodNotAllowed(w)
+		}
+	}
+}
+
+// DisplayNameHandler handles PUT requests setting the name shown for the user instead of their username, and DELETE
+// requests clearing it. Names that look like another member's name are rejected so they can't be impersonated.
+// The new name is used from the user's next connection.
+func DisplayNameHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := services.Auth.Authorise(r)
+		if err != nil {
+			apierror.Unauthorised(w)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			v, err := validation.New(r)
+			if err != nil {
+				validation.WriteBodyError(w, err)
+				return
+			}
+
+			displayName := usernames.Normalize(v.Get("displayName"))
+			message, ok := services.UsernameRules.ValidateDisplayName(displayName)
+			v.Check(ok, "displayName", message)
+			if ok {
+				members, err := services.DB.GetMembers(user.TenantID)
+				if err != nil {
+					log.Printf("Failed to get members: %v", err)
+					apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to set display name")
+					return
+				}
+				message, ok := lookalikeOf(members, user.ID, displayName)
+				v.Check(ok, "displayName", message)
+			}
+			if !v.Valid() {
+				v.WriteError(w, http.StatusBadRequest)
+				return
+			}
+
+			if err := services.DB.SetDisplayName(user.ID, displayName); err != nil {
+				log.Printf("Failed to set display name: %v", err)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to set display name")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		case http.MethodDelete:
+			if err := services.DB.SetDisplayName(user.ID, ""); err != nil {
+				log.Printf("Failed to clear display name: %v", err)
+				apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to clear display name")
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			apierror.MethodNotAllowed(w)
+		}
+	}
+}
+
+// lookalikeOf checks a display name doesn't look like another member's username or display name.
+// Users may pick a lookalike of their own username.
+func lookalikeOf(members []models.User, userID int, displayName string) (string, bool) {
+	skeleton := usernames.Skeleton(displayName)
+	for _, member := range members {
+		if member.ID == userID {
+			continue
+		}
+		for _, name := range []string{member.Username, member.DisplayName} {
+			if name == "" || usernames.Skeleton(name) != skeleton {
+				continue
+			}
+			if member.IsAdmin {
+				return "looks too similar to an admin's name", false
+			}
+			return "looks too similar to another member's name", false
+		}
+	}
+	return "", true
+}
+
+// EmailHandler handles PUT requests setting the address emails for the user, such as transcripts, are sent to, and
+// DELETE requests clearing it.
+func EmailHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := services.Auth.Authorise(r)
+		if err != nil {
+			apierror.Unauthorised(w)
+			return
+		}
+
+		email := ""
+		switch r.Method {
+		case http.MethodPut:
+			v, err := validation.New(r)
+			if err != nil {
+				validation.WriteBodyError(w, err)
+				return
+			}
+
+			address, err := mail.ParseAddress(v.Get("email"))
+			v.Check(err == nil && address.Name == "", "email", "must be an email address")
+			if !v.Valid() {
+				v.WriteError(w, http.StatusBadRequest)
+				return
+			}
+			email = address.Address
+
+		case http.MethodDelete:
+			// Clears the email address
+
+		default:
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		if err := services.DB.SetEmail(user.ID, email); err != nil {
+			log.Printf("Failed to set email: %v", err)
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Failed to set email")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// PresenceHandler handles GET requests listing the users connected to the tenant, with whether they are active or
+// idle and how many devices they are connected from. Bots and dashboards can use the tenant's API key instead of a
+// session.
+func PresenceHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		// The tenant middleware has already rejected invalid API keys
+		if r.Header.Get("X-API-Key") == "" {
+			if _, err := services.Auth.Authorise(r); err != nil {
+				apierror.Unauthorised(w)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(utils.CollectPresence(tenants.IDFromContext(r.Context()), services.Clock.Now()))
+	}
+}
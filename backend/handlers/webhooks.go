@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"go-chat-app/analytics"
+	"go-chat-app/apierror"
+	"go-chat-app/broadcast"
+	"go-chat-app/models"
+	"go-chat-app/protocol"
+	"go-chat-app/services"
+	"go-chat-app/tenants"
+	"go-chat-app/usernames"
+	"go-chat-app/validation"
+	"go-chat-app/webhooks"
+)
+
+// Limits on inbound webhook messages
+const (
+	maxWebhookBytes   = 64 << 10
+	maxWebhookContent = 4000
+)
+
+// webhookMessage is the body of an inbound webhook message.
+type webhookMessage struct {
+	Sender  string `json:"sender"` // Name of the bot or integration
+	Content string `json:"content"`
+}
+
+// WebhookMessagesHandler handles POST requests from bots and integrations posting a message to the tenant's chat.
+// Requests must be signed with the tenant's webhook secret, and the message is broadcast marked as verified.
+func WebhookMessagesHandler(services *services.Services) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			apierror.MethodNotAllowed(w)
+			return
+		}
+
+		tenant, _ := tenants.FromContext(r.Context())
+		if tenant.WebhookSecret == "" {
+			apierror.Write(w, http.StatusForbidden, apierror.CodeForbidden, "Webhooks aren't enabled for this tenant")
+			return
+		}
+
+		// The signature covers the exact bytes sent, so read the body before decoding it
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBytes+1))
+		if err != nil || len(body) > maxWebhookBytes {
+			apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodeBadRequest, "Request body is too large")
+			return
+		}
+
+		err = webhooks.Verify(tenant.WebhookSecret, r.Header.Get(webhooks.TimestampHeader), r.Header.Get(webhooks.SignatureHeader), body, services.Clock.Now())
+		if err != nil {
+			log.Printf("Rejected webhook message for tenant %d: %v", tenant.ID, err)
+			apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnauthorised, "Invalid webhook signature")
+			return
+		}
+
+		var payload webhookMessage
+		if err := json.Unmarshal(body, &payload); err != nil {
+			validation.WriteBodyError(w, err)
+			return
+		}
+
+		sender := usernames.Normalize(payload.Sender)
+		content := strings.TrimSpace(payload.Content)
+		var errs []validation.FieldError
+		if message, ok := services.UsernameRules.ValidateDisplayName(sender); !ok {
+			errs = append(errs, validation.FieldError{Field: "sender", Message: message})
+		}
+		if content == "" {
+			errs = append(errs, validation.FieldError{Field: "content", Message: "is required"})
+		} else if len(content) > maxWebhookContent {
+			errs = append(errs, validation.FieldError{Field: "content", Message: fmt.Sprintf("must be at most %d characters", maxWebhookContent)})
+		}
+		if len(errs) > 0 {
+			apierror.WriteDetails(w, http.StatusBadRequest, apierror.CodeValidationFailed, "Validation failed", errs)
+			return
+		}
+
+		broadcast.BroadcastMessage(r.Context(), models.Message{
+			ID:        services.MessageIDs.Next(),
+			TenantID:  tenant.ID,
+			Sender:    sender,
+			Content:   content,
+			Verified:  true,
+			Timestamp: services.Clock.Now(),
+		})
+		services.Analytics.Track(analytics.MessageSent, tenant.ID, 0, map[string]any{
+			"type":   protocol.TypeChat,
+			"length": utf8.RuneCountInString(content),
+			"source": "webhook",
+		})
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
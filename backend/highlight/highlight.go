@@ -0,0 +1,51 @@
+package highlight
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// Syntax highlighting for code snippet messages. Highlighting is done once on the server, with inline styles rather
+// than CSS classes, so every client renders a snippet identically without shipping its own highlighter or theme.
+
+// MaxSourceBytes limits the size of a code snippet, as highlighting cost grows with the input.
+const MaxSourceBytes = 64 << 10
+
+// ErrTooLarge is returned for snippets over MaxSourceBytes.
+var ErrTooLarge = errors.New("code snippet too large")
+
+var formatter = html.New(html.WithClasses(false), html.TabWidth(4))
+
+// Code highlights source code as HTML and returns the lexer's canonical language name.
+// An unknown or empty language is guessed from the source, falling back to plain text.
+func Code(language, source string) (highlighted, canonical string, err error) {
+	if len(source) > MaxSourceBytes {
+		return "", "", ErrTooLarge
+	}
+
+	lexer := lexers.Get(strings.TrimSpace(language))
+	if lexer == nil {
+		lexer = lexers.Analyse(source)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, source)
+	if err != nil {
+		return "", "", err
+	}
+
+	var buf bytes.Buffer
+	if err := formatter.Format(&buf, styles.Get("github"), iterator); err != nil {
+		return "", "", err
+	}
+	return buf.String(), strings.ToLower(lexer.Config().Name), nil
+}
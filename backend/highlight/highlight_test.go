@@ -0,0 +1,39 @@
+package highlight_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go-chat-app/highlight"
+)
+
+func TestCode_HighlightsKnownLanguage(t *testing.T) {
+	highlighted, language, err := highlight.Code("go", "package main\n\nfunc main() {}\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if language != "go" {
+		t.Errorf("expected language go, got %q", language)
+	}
+	if !strings.Contains(highlighted, "<pre") || !strings.Contains(highlighted, "style=") {
+		t.Errorf("expected HTML with inline styles, got %q", highlighted)
+	}
+}
+
+func TestCode_EscapesSource(t *testing.T) {
+	highlighted, _, err := highlight.Code("", "<script>alert(1)</script>")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(highlighted, "<script>") {
+		t.Errorf("expected source to be escaped, got %q", highlighted)
+	}
+}
+
+func TestCode_RejectsLargeSnippets(t *testing.T) {
+	_, _, err := highlight.Code("go", strings.Repeat("x", highlight.MaxSourceBytes+1))
+	if !errors.Is(err, highlight.ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+}
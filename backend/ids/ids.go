@@ -0,0 +1,33 @@
+package ids
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+// Generator creates unique IDs, such as for WebSocket connections. Code takes a Generator instead of calling uuid.New
+// so tests can use predictable IDs.
+type Generator interface {
+	NewID() string
+}
+
+// UUID generates random (version 4) UUIDs.
+type UUID struct{}
+
+// NewID returns a new random UUID.
+func (UUID) NewID() string {
+	return uuid.New().String()
+}
+
+// Sequence generates IDs from a prefix and a counter, e.g. "client-1", "client-2", for tests.
+type Sequence struct {
+	Prefix string
+	next   atomic.Int64
+}
+
+// NewID returns the next ID in the sequence.
+func (s *Sequence) NewID() string {
+	return s.Prefix + strconv.FormatInt(s.next.Add(1), 10)
+}
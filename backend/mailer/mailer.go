@@ -0,0 +1,83 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Outgoing email, sent through an SMTP relay configured with SMTP_HOST, SMTP_PORT (default 587), SMTP_USERNAME,
+// SMTP_PASSWORD and MAIL_FROM. Features that send email are unavailable when SMTP_HOST isn't set.
+
+// Mail is an HTML email.
+type Mail struct {
+	To      []string
+	Subject string
+	HTML    string
+}
+
+// Mailer sends email.
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
+
+// SMTPMailer sends email through an SMTP relay, using STARTTLS when the server supports it.
+type SMTPMailer struct {
+	addr string
+	host string
+	auth smtp.Auth // Nil if the relay doesn't need authentication
+	from string
+}
+
+// LoadSMTP reads the SMTP relay config from the environment, returning nil if SMTP_HOST isn't set.
+func LoadSMTP() (*SMTPMailer, error) {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil, nil
+	}
+
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		return nil, fmt.Errorf("MAIL_FROM is required when SMTP_HOST is set")
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+
+	mailer := &SMTPMailer{addr: net.JoinHostPort(host, port), host: host, from: from}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		mailer.auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return mailer, nil
+}
+
+// Send sends an email. smtp.SendMail doesn't take a context, so cancellation only applies before sending starts.
+func (m *SMTPMailer) Send(ctx context.Context, mail Mail) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := smtp.SendMail(m.addr, m.auth, m.from, mail.To, Compose(m.from, mail, time.Now())); err != nil {
+		return fmt.Errorf("failed to send email to %s: %w", strings.Join(mail.To, ", "), err)
+	}
+	return nil
+}
+
+// Compose builds the raw message for an email.
+func Compose(from string, mail Mail, now time.Time) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + strings.Join(mail.To, ", ") + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", mail.Subject) + "\r\n")
+	b.WriteString("Date: " + now.Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(mail.HTML)
+	return []byte(b.String())
+}
@@ -1,29 +1,67 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"time"
 
+	"go-chat-app/archive"
 	"go-chat-app/broadcast"
+	"go-chat-app/outbox"
 	"go-chat-app/routes"
+	"go-chat-app/scheduler"
 	"go-chat-app/services"
+	"go-chat-app/tracing"
 )
 
 // main program entry point.
 func main() {
+	shutdownTracing, err := tracing.Init(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to initialise tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	mySQLDB, services := services.InitialiseServices()
 
+	broadcaster, err := broadcast.NewBroadcasterFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialise broadcaster: %v", err)
+	}
+	defer broadcaster.Close()
+
 	// Inject dependencies for use by routes and broadcast listeners
 	routes.SetupRoutes(services)
-	broadcast.InitBroadcast(mySQLDB)
+	broadcast.InitBroadcast(mySQLDB, broadcaster, services.Flags)
 
 	// Launch background processes
 	go broadcast.StartBroadcastListener()
 	go broadcast.StartNotifyActiveUsers()
+	go broadcast.StartStatsPublisher()
+	go scheduler.StartEventScheduler(mySQLDB, services.MessageIDs)
+	if services.Analytics != nil {
+		go services.Analytics.Run(context.Background())
+	}
+	if kafkaSink := outbox.LoadKafkaSink(); kafkaSink != nil {
+		defer kafkaSink.Close()
+		go outbox.NewDispatcher(mySQLDB, kafkaSink).Start(context.Background())
+	}
+	if services.Archive != nil {
+		go archive.NewArchiver(mySQLDB, services.Archive).Start(context.Background())
+	}
 
 	// Start the server
 	log.Println("Server started on :8080")
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	// Headers must arrive promptly so slowloris clients can't hold connections open. There is no overall read or
+	// write timeout as WebSocket connections are long lived; REST routes get per-route limits instead
+	server := &http.Server{
+		Addr:              ":8080",
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    64 << 10,
+	}
+	log.Fatal(server.ListenAndServe())
 }
 
 // Run Command: `go run main.go`
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Compression of REST responses, negotiated with Accept-Encoding. Brotli is preferred over gzip when the client
+// accepts both equally. Flushing the response flushes the encoder too, so streamed responses such as NDJSON exports
+// reach the client as they are written.
+
+// compressible lists the content types worth compressing. Everything else, such as images, is sent as is.
+var compressible = map[string]bool{
+	"application/json":     true,
+	"application/x-ndjson": true,
+	"text/html":            true,
+	"text/plain":           true,
+	"text/csv":             true,
+}
+
+// Encodings the server supports, most preferred first
+var encodings = []string{"br", "gzip"}
+
+// Compress compresses responses the client accepts a supported encoding for.
+func Compress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks the supported encoding with the highest quality in an Accept-Encoding header.
+func negotiateEncoding(header string) string {
+	best, bestQuality := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		for _, encoding := range encodings {
+			// Ties go to the encoding listed first in encodings
+			if strings.EqualFold(name, encoding) && quality > 0 && (quality > bestQuality || quality == bestQuality && preferred(encoding, best)) {
+				best, bestQuality = encoding, quality
+			}
+		}
+	}
+	return best
+}
+
+// preferred reports whether encoding a is listed before b in encodings.
+func preferred(a, b string) bool {
+	for _, encoding := range encodings {
+		if encoding == a {
+			return true
+		}
+		if encoding == b {
+			return false
+		}
+	}
+	return false
+}
+
+// compressWriter compresses the response body once the handler's headers show it is worth compressing.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	encoder     io.WriteCloser // Nil until the first write, and if the response isn't being compressed
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	header := cw.Header()
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if compressible[mediaType] && header.Get("Content-Encoding") == "" && status != http.StatusNoContent && status != http.StatusNotModified {
+		header.Set("Content-Encoding", cw.encoding)
+		header.Del("Content-Length") // The length is of the uncompressed body
+		if cw.encoding == "br" {
+			cw.encoder = brotli.NewWriterLevel(cw.ResponseWriter, brotli.DefaultCompression)
+		} else {
+			cw.encoder = gzip.NewWriter(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.encoder == nil {
+		return cw.ResponseWriter.Write(p)
+	}
+	return cw.encoder.Write(p)
+}
+
+// Flush sends everything written so far to the client.
+func (cw *compressWriter) Flush() {
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close finishes the compressed stream.
+func (cw *compressWriter) Close() error {
+	if cw.encoder == nil {
+		return nil
+	}
+	return cw.encoder.Close()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := map[string]string{
+		"":                      "",
+		"identity":              "",
+		"gzip":                  "gzip",
+		"gzip, deflate, br":     "br",
+		"br;q=0.5, gzip":        "gzip",
+		"gzip;q=0, br;q=0":      "",
+		"GZIP;q=0.8, br;q=0.8":  "br",
+		"deflate, gzip;q=bogus": "",
+	}
+	for header, want := range tests {
+		if got := negotiateEncoding(header); got != want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	body := `[` + strings.Repeat(`{"sender":"user1","content":"hello"},`, 100) + `{}]`
+	handler := Compress(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+	for encoding, decoder := range decoders {
+		req := httptest.NewRequest(http.MethodGet, "/history", nil)
+		req.Header.Set("Accept-Encoding", encoding)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Header().Get("Content-Encoding") != encoding {
+			t.Fatalf("expected %s encoding, got %q", encoding, w.Header().Get("Content-Encoding"))
+		}
+		if w.Body.Len() >= len(body) {
+			t.Errorf("expected %s to shrink the body, got %d bytes from %d", encoding, w.Body.Len(), len(body))
+		}
+		reader, err := decoder(w.Body)
+		if err != nil {
+			t.Fatalf("failed to open %s body: %v", encoding, err)
+		}
+		if decoded, _ := io.ReadAll(reader); string(decoded) != body {
+			t.Errorf("expected %s body to decode to the original", encoding)
+		}
+	}
+
+	// Clients that don't accept compression get the body as is
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/history", nil))
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != body {
+		t.Error("expected an uncompressed response")
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("expected Vary: Accept-Encoding, got %q", w.Header().Get("Vary"))
+	}
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-chat-app/apierror"
+)
+
+// Limits protect the server from slow clients and oversized payloads. Requests over the body limit get a 413, and
+// requests whose handler takes longer than the timeout get a 504.
+type Limits struct {
+	Timeout      time.Duration
+	MaxBodyBytes int64
+}
+
+// DefaultLimits suit most REST routes, which take small form or JSON bodies and answer quickly.
+var DefaultLimits = Limits{Timeout: 30 * time.Second, MaxBodyBytes: 1 << 20}
+
+// WithLimits applies request limits. It must not wrap WebSocket routes, as the response is buffered until the
+// handler returns.
+func WithLimits(limits Limits) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limits.MaxBodyBytes {
+				apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "Request body is too large")
+				return
+			}
+			// Chunked bodies have no length up front, so reads past the limit fail instead
+			r.Body = http.MaxBytesReader(w, r.Body, limits.MaxBodyBytes)
+
+			ctx, cancel := context.WithTimeout(r.Context(), limits.Timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+
+			// The handler writes to a buffer so its response can be discarded if it runs out of time
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				panic(p)
+
+			case <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				for key, values := range tw.header {
+					w.Header()[key] = values
+				}
+				if tw.status == 0 {
+					tw.status = http.StatusOK
+				}
+				w.WriteHeader(tw.status)
+				w.Write(tw.body.Bytes())
+
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.timedOut = true
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					apierror.Write(w, http.StatusGatewayTimeout, apierror.CodeTimeout, "Request timed out")
+				}
+			}
+		})
+	}
+}
+
+// timeoutWriter buffers a response until the handler finishes, dropping writes made after the request timed out.
+type timeoutWriter struct {
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.status == 0 {
+		tw.status = http.StatusOK
+	}
+	return tw.body.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.status != 0 {
+		return
+	}
+	tw.status = status
+}
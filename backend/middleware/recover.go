@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go-chat-app/apierror"
+	"go-chat-app/utils"
+)
+
+// Recover turns a panic in a handler into a 500 response, so the panic is logged with its stack trace and doesn't
+// take down the process. http.ErrAbortHandler is passed on, as it's how handlers deliberately abort a response.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			utils.LogPanic(p, "handler for %s %s", r.Method, r.URL.Path)
+			// WithLimits buffers responses, so on REST routes nothing has been sent yet. Hijacked WebSocket
+			// connections can't be written to, so this is a no-op for them
+			apierror.Write(w, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
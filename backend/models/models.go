@@ -1,33 +1,191 @@
 package models
 
 import (
+	"context"
+	"sync"
 	"time"
 
+	"go-chat-app/frames"
+	"go-chat-app/protocol"
+
 	"github.com/gorilla/websocket"
 )
 
 // Client represents a WebSocket client .
 type Client struct {
 	ID          string
+	TenantID    int
+	UserID      int
 	DisplayName string
+	IsAdmin     bool // As of connecting, so a revoked admin keeps admin frames until they reconnect
+	IP          string
+	ConnectedAt time.Time
 	Conn        *websocket.Conn
-	Send        chan []byte
+	Send        chan *frames.Frame // The writer releases each frame once written
+
+	mu           sync.Mutex  // Guards the fields below, which are shared between the read loop and the broadcasters
+	messageTimes []time.Time // Times of messages received in the last minute
+	lastActiveAt time.Time   // When the client last sent a frame, or connected
+	capabilities protocol.Capabilities
+	location     *time.Location // Loaded from the agreed time zone
+}
+
+// Capabilities returns the feature set agreed with the client.
+func (c *Client) Capabilities() protocol.Capabilities {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.capabilities
+}
+
+// SetCapabilities stores the feature set agreed with the client.
+func (c *Client) SetCapabilities(capabilities protocol.Capabilities) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.capabilities = capabilities
+	c.location = capabilities.Location()
+}
+
+// Location returns the time zone to show times in for the client.
+func (c *Client) Location() *time.Location {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.location == nil {
+		return time.UTC
+	}
+	return c.location
+}
+
+// RecordMessage records that the client sent a message, for rate statistics.
+func (c *Client) RecordMessage(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messageTimes = append(c.pruneMessageTimes(now), now)
+}
+
+// RecordActivity records that the client sent a frame, so it isn't idle.
+func (c *Client) RecordActivity(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastActiveAt = now
+}
+
+// LastActive returns when the client last sent a frame, or when it connected if it hasn't sent any.
+func (c *Client) LastActive() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastActiveAt.IsZero() {
+		return c.ConnectedAt
+	}
+	return c.lastActiveAt
+}
+
+// MessagesPerMinute returns how many messages the client sent in the last minute.
+func (c *Client) MessagesPerMinute(now time.Time) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messageTimes = c.pruneMessageTimes(now)
+	return len(c.messageTimes)
+}
+
+// pruneMessageTimes drops message times older than a minute. Caller must hold mu.
+func (c *Client) pruneMessageTimes(now time.Time) []time.Time {
+	cutoff := now.Add(-time.Minute)
+	i := 0
+	for i < len(c.messageTimes) && c.messageTimes[i].Before(cutoff) {
+		i++
+	}
+	return c.messageTimes[i:]
 }
 
 // Message represents a chat message.
 type Message struct {
-	Sender    string    `json:"sender"`
-	Content   string    `json:"content"`
-	Timestamp time.Time `json:"timestamp"`
+	ID          int             `json:"id,omitempty"`   // Database ID, set once the message is saved. Clients use it to react to messages
+	TenantID    int             `json:"-"`              // Set server side from the sender's tenant, never trusted from the client
+	Type        string          `json:"type,omitempty"` // "code" for code snippets, empty for plain chat messages
+	Sender      string          `json:"sender"`
+	Language    string          `json:"language,omitempty"`    // Language of a code snippet
+	Content     string          `json:"content"`               // Message text, or the raw source of a code snippet
+	Highlighted string          `json:"highlighted,omitempty"` // Server highlighted HTML of a code snippet
+	Verified    bool            `json:"verified,omitempty"`    // Posted by a bot or integration with a valid signature
+	Timestamp   time.Time       `json:"timestamp"`
+	Reactions   []ReactionCount `json:"reactions,omitempty"` // Only filled in for history
+}
+
+// ReactionCount is how many users reacted to a message with an emoji, and who.
+type ReactionCount struct {
+	Emoji string   `json:"emoji"`
+	Count int      `json:"count"`
+	Users []string `json:"users"`
+}
+
+// ReactionToggle is sent by a client to add a reaction to a message, or remove it if they already reacted with it.
+type ReactionToggle struct {
+	Type      string `json:"type"` // Always "reaction"
+	MessageID int    `json:"messageId"`
+	Emoji     string `json:"emoji"`
+}
+
+// ReactionUpdate tells clients that a user added or removed a reaction.
+type ReactionUpdate struct {
+	Type      string `json:"type"` // Always "reaction"
+	MessageID int    `json:"messageId"`
+	Emoji     string `json:"emoji"`
+	User      string `json:"user"`
+	Added     bool   `json:"added"` // False if the reaction was removed
+	Count     int    `json:"count"` // Number of users now reacting with the emoji
+}
+
+// PlainText returns the message as a plain chat message, for clients that don't support its type.
+// Code snippets fall back to their raw source.
+func (m Message) PlainText() Message {
+	m.Type = ""
+	m.Language = ""
+	m.Highlighted = ""
+	m.Reactions = nil
+	return m
+}
+
+// MessageArchive is a page of old messages moved out of the database into cold storage.
+type MessageArchive struct {
+	ID             int       `json:"id"`
+	TenantID       int       `json:"-"`
+	ObjectKey      string    `json:"-"`
+	FirstMessageID int       `json:"-"`
+	LastMessageID  int       `json:"-"`
+	From           time.Time `json:"from"` // Timestamp of the oldest message in the page
+	To             time.Time `json:"to"`   // Timestamp of the newest message in the page
+	MessageCount   int       `json:"messageCount"`
+}
+
+// OutboundMessage is a chat message, or another frame for a whole tenant, queued for fan-out along with the context
+// it was sent in for tracing.
+type OutboundMessage struct {
+	Ctx     context.Context
+	Message Message
+	Frame   *TenantFrame // Set instead of Message for frames other than chat messages
+}
+
+// TenantFrame is an encoded frame, such as a reaction update, for every client in a tenant that supports its type.
+type TenantFrame struct {
+	TenantID int
+	Type     string
+	Payload  []byte // JSON encoded frame
 }
 
 // User represents a user in the db.
 type User struct {
 	ID             int
+	TenantID       int
 	Username       string
+	DisplayName    string // Shown instead of the username when set
+	Email          string // Empty if the user hasn't set one
 	HashedPassword string
 	SessionToken   string
 	CSRFToken      string
+	IsAdmin        bool
+	LastSeenAt     *time.Time // Nil if the user has never connected
+	IsGuest        bool       // Guests have no account, so no ID, and a generated username
+	DeactivatedAt  *time.Time // Nil unless the account is deactivated
 }
 
 // ActiveUsersMessage represents the list of active users sent to all clients.
@@ -35,3 +193,106 @@ type ActiveUsersMessage struct {
 	Type  string   `json:"type"`  // Always "activeUsers"
 	Users []string `json:"users"` // List of active display names
 }
+
+// Tenant represents an isolated chat instance hosted by this deployment.
+type Tenant struct {
+	ID       int
+	Name     string
+	Hostname string
+	APIKey   string
+
+	WebhookSecret string // Empty if the tenant doesn't accept webhook messages
+}
+
+// Event represents a scheduled chat event that is announced when it starts, with a reminder beforehand.
+type Event struct {
+	ID        int       `json:"id"`
+	TenantID  int       `json:"-"`
+	Title     string    `json:"title"`
+	StartsAt  time.Time `json:"startsAt"`
+	CreatedBy string    `json:"createdBy"`
+	Reminded  bool      `json:"-"`
+	Announced bool      `json:"-"`
+	Cancelled bool      `json:"-"`
+}
+
+// MOTD is a tenant's message of the day.
+type MOTD struct {
+	Type      string    `json:"type"`    // Always "motd"
+	Sender    string    `json:"sender"`  // Always "System", so clients without MOTD support show it as a chat message
+	Content   string    `json:"content"` // Empty if no message of the day is set
+	UpdatedBy string    `json:"updatedBy,omitempty"`
+	Timestamp time.Time `json:"timestamp"` // When it was last updated
+}
+
+// FeatureFlag is a tenant's setting for a feature flag.
+type FeatureFlag struct {
+	Name       string    `json:"name"`
+	Enabled    bool      `json:"enabled"`    // Off for everyone when false
+	Percentage int       `json:"percentage"` // Share of users the flag is on for when enabled, 0 to 100
+	UserIDs    []int     `json:"-"`          // Users the flag is always on for when enabled
+	Users      []string  `json:"users"`      // Usernames of UserIDs
+	Default    bool      `json:"default"`    // The tenant hasn't configured the flag, so the instance default applies
+	UpdatedBy  string    `json:"updatedBy,omitempty"`
+	UpdatedAt  time.Time `json:"updatedAt,omitempty"`
+}
+
+// Notice is a system notice sent to a single client, e.g. when it is rate limited.
+type Notice struct {
+	Type      string    `json:"type"`    // Always "notice"
+	Code      string    `json:"code"`    // Machine readable reason, e.g. "rate_limited" or "muted"
+	Sender    string    `json:"sender"`  // Always "System", so clients without notice support show it as a chat message
+	Content   string    `json:"content"` // Human readable message
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Preferences are a user's personal settings.
+type Preferences struct {
+	TimeZone     string      `json:"timeZone"`     // IANA time zone the Do Not Disturb windows are in, default UTC
+	DoNotDisturb []DNDWindow `json:"doNotDisturb"` // Windows during which notifications are suppressed
+}
+
+// DNDWindow is a daily Do Not Disturb window. A window ending before it starts runs overnight into the next day.
+type DNDWindow struct {
+	Start string `json:"start"`          // Start time as HH:MM
+	End   string `json:"end"`            // End time as HH:MM
+	Days  []int  `json:"days,omitempty"` // Days the window starts on, 0 (Sunday) to 6. Empty means every day
+}
+
+// UserStatus describes whether a user is online, and when they were last seen if not.
+type UserStatus struct {
+	Username    string     `json:"username"`
+	Online      bool       `json:"online"`
+	LastSeenAt  *time.Time `json:"lastSeenAt"` // Null if the user has never connected
+	Deactivated bool       `json:"deactivated"`
+}
+
+// ConnectionInfo describes an active WebSocket connection for admins.
+type ConnectionInfo struct {
+	ID                string    `json:"id"`
+	Username          string    `json:"username"`
+	IP                string    `json:"ip"`
+	ConnectedAt       time.Time `json:"connectedAt"`
+	MessagesPerMinute int       `json:"messagesPerMinute"`
+}
+
+// Stats is a frame of live server health sent to a tenant's admins. Figures cover the tenant's clients on the
+// instance the admin is connected to.
+type Stats struct {
+	Type              string    `json:"type"` // Always "stats"
+	ConnectedUsers    int       `json:"connectedUsers"`
+	Connections       int       `json:"connections"`
+	MessagesPerSecond float64   `json:"messagesPerSecond"` // Chat and code messages fanned out since the last stats frame
+	QueueDepth        int       `json:"queueDepth"`        // Outbound frames waiting to be written, across all connections
+	MaxQueueDepth     int       `json:"maxQueueDepth"`     // Outbound frames waiting for the most backed up connection
+	Timestamp         time.Time `json:"timestamp"`
+}
+
+// Presence describes a user's presence across all of their connections.
+type Presence struct {
+	Username     string    `json:"username"`
+	Status       string    `json:"status"` // "active", or "idle" if none of their connections have sent anything recently
+	Devices      int       `json:"devices"`
+	LastActiveAt time.Time `json:"lastActiveAt"`
+	Guest        bool      `json:"guest,omitempty"`
+}
@@ -0,0 +1,112 @@
+package origins
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Origin policy shared by the CORS middleware and the WebSocket handshake, so browsers can only make credentialed
+// requests and open WebSockets from the same set of sites.
+//
+// ALLOWED_ORIGINS is a comma separated list of entries, each either an exact origin ("https://chat.example.com") or a
+// wildcard subdomain ("https://*.example.com", which matches any subdomain but not example.com itself). "*" allows
+// every origin, but only when APP_ENV=development.
+
+// Policy decides which browser origins are allowed.
+type Policy struct {
+	exact     map[string]bool
+	wildcards []wildcard
+	allowAll  bool
+}
+
+// wildcard matches subdomains of a domain on one scheme
+type wildcard struct {
+	scheme string
+	suffix string // e.g. ".example.com"
+}
+
+// LoadPolicy reads the origin policy from ALLOWED_ORIGINS, defaulting to the local frontend dev server.
+func LoadPolicy() *Policy {
+	raw, ok := os.LookupEnv("ALLOWED_ORIGINS")
+	if !ok {
+		raw = "http://localhost:3000"
+	}
+	return ParsePolicy(raw, os.Getenv("APP_ENV") == "development")
+}
+
+// ParsePolicy parses a comma separated list of allowed origins. "*" is ignored unless dev is true.
+func ParsePolicy(raw string, dev bool) *Policy {
+	p := &Policy{exact: make(map[string]bool)}
+
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSuffix(strings.TrimSpace(entry), "/")
+		switch {
+		case entry == "":
+			continue
+
+		case entry == "*":
+			if !dev {
+				log.Println("Ignoring allow-all origin outside development, set APP_ENV=development to allow it")
+				continue
+			}
+			p.allowAll = true
+
+		case strings.Contains(entry, "://*."):
+			scheme, host, _ := strings.Cut(entry, "://*.")
+			p.wildcards = append(p.wildcards, wildcard{scheme: strings.ToLower(scheme), suffix: "." + strings.ToLower(host)})
+
+		default:
+			p.exact[strings.ToLower(entry)] = true
+		}
+	}
+
+	return p
+}
+
+// Allowed reports whether a browser origin, e.g. "https://chat.example.com", is allowed.
+func (p *Policy) Allowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if p.allowAll {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if p.exact[origin] {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	for _, w := range p.wildcards {
+		if u.Scheme == w.scheme && strings.HasSuffix(u.Host, w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckWebSocketOrigin is used as the WebSocket upgrader's CheckOrigin.
+// Requests without an Origin header come from non-browser clients such as bots, which aren't subject to the policy,
+// and pages served by the backend itself are always allowed.
+func (p *Policy) CheckWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	if p.Allowed(origin) {
+		return true
+	}
+
+	log.Printf("Rejected WebSocket connection from origin %s", origin)
+	return false
+}
@@ -0,0 +1,60 @@
+package origins_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"go-chat-app/origins"
+)
+
+func TestAllowed(t *testing.T) {
+	policy := origins.ParsePolicy("http://localhost:3000, https://*.example.com, *", false)
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"http://localhost:3000", true},
+		{"http://localhost:3001", false},
+		{"https://chat.example.com", true},
+		{"https://a.b.example.com", true},
+		{"https://example.com", false},     // Wildcards only match subdomains
+		{"http://chat.example.com", false}, // on the same scheme
+		{"https://evilexample.com", false},
+		{"https://example.com.evil.com", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := policy.Allowed(tt.origin); got != tt.want {
+			t.Errorf("Allowed(%q): expected %v, got %v", tt.origin, tt.want, got)
+		}
+	}
+}
+
+func TestAllowAllOnlyInDevelopment(t *testing.T) {
+	if origins.ParsePolicy("*", false).Allowed("https://anywhere.com") {
+		t.Error("expected allow-all to be ignored outside development")
+	}
+	if !origins.ParsePolicy("*", true).Allowed("https://anywhere.com") {
+		t.Error("expected allow-all in development")
+	}
+}
+
+func TestCheckWebSocketOrigin(t *testing.T) {
+	policy := origins.ParsePolicy("http://localhost:3000", false)
+
+	r := httptest.NewRequest("GET", "http://chat.internal/ws", nil)
+	if !policy.CheckWebSocketOrigin(r) {
+		t.Error("expected requests without an Origin to be allowed")
+	}
+
+	r.Header.Set("Origin", "http://chat.internal")
+	if !policy.CheckWebSocketOrigin(r) {
+		t.Error("expected same-host requests to be allowed")
+	}
+
+	r.Header.Set("Origin", "https://evil.com")
+	if policy.CheckWebSocketOrigin(r) {
+		t.Error("expected other origins to be rejected")
+	}
+}
@@ -0,0 +1,85 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-chat-app/models"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaSink publishes messages to a Kafka topic, keyed by tenant so each tenant's messages stay in order.
+type KafkaSink struct {
+	writer *kafka.Writer
+}
+
+// kafkaRecord is the JSON value of each Kafka record.
+type kafkaRecord struct {
+	ID        int       `json:"id"`
+	TenantID  int       `json:"tenant_id"`
+	Sender    string    `json:"sender"`
+	Content   string    `json:"content"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// LoadKafkaSink creates a Kafka sink from KAFKA_BROKERS (comma separated) and KAFKA_TOPIC (default chat-messages).
+// Returns nil if no brokers are configured, as the sink is optional.
+func LoadKafkaSink() *KafkaSink {
+	if os.Getenv("KAFKA_BROKERS") == "" {
+		return nil
+	}
+
+	topic := os.Getenv("KAFKA_TOPIC")
+	if topic == "" {
+		topic = "chat-messages"
+	}
+	return NewKafkaSink(strings.Split(os.Getenv("KAFKA_BROKERS"), ","), topic)
+}
+
+// NewKafkaSink creates a sink publishing to a topic on the given brokers.
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			RequiredAcks: kafka.RequireAll, // Only count a message as delivered once every in-sync replica has it
+		},
+	}
+}
+
+// Name identifies the Kafka sink's outbox cursor.
+func (s *KafkaSink) Name() string {
+	return "kafka"
+}
+
+// Deliver publishes a batch of messages, failing if any of them could not be written.
+func (s *KafkaSink) Deliver(ctx context.Context, messages []models.Message) error {
+	records := make([]kafka.Message, 0, len(messages))
+	for _, msg := range messages {
+		value, err := json.Marshal(kafkaRecord{
+			ID:        msg.ID,
+			TenantID:  msg.TenantID,
+			Sender:    msg.Sender,
+			Content:   msg.Content,
+			Timestamp: msg.Timestamp,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode message %d: %w", msg.ID, err)
+		}
+		records = append(records, kafka.Message{Key: []byte(strconv.Itoa(msg.TenantID)), Value: value})
+	}
+
+	return s.writer.WriteMessages(ctx, records...)
+}
+
+// Close flushes and closes the Kafka writer.
+func (s *KafkaSink) Close() error {
+	return s.writer.Close()
+}
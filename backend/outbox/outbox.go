@@ -0,0 +1,114 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go-chat-app/clock"
+	"go-chat-app/db"
+	"go-chat-app/models"
+	"go-chat-app/snowflake"
+	"go-chat-app/tracing"
+)
+
+// Default dispatcher settings
+const (
+	pollInterval = 5 * time.Second
+	batchSize    = 100
+	settleDelay  = 2 * time.Second
+)
+
+// Sink receives every persisted message, e.g. to feed analytics or compliance pipelines.
+type Sink interface {
+	Name() string // Identifies the sink's cursor, so must stay the same between restarts
+	Deliver(ctx context.Context, messages []models.Message) error
+}
+
+// Dispatcher delivers persisted messages to a sink in ID order, with at-least-once delivery.
+// The messages table acts as the outbox: the dispatcher stores the ID of the last message the sink accepted and only
+// advances it after a successful delivery, so a failed or interrupted batch is delivered again.
+//
+// Message IDs are generated by each instance at intake, so a message can be saved slightly after one with a later ID
+// from another instance. Messages are only delivered once their ID is settleDelay old, so the cursor doesn't pass a
+// message that is still being saved.
+type Dispatcher struct {
+	db           db.DBInterface
+	sink         Sink
+	clock        clock.Clock
+	pollInterval time.Duration
+	batchSize    int
+	settleDelay  time.Duration
+}
+
+// NewDispatcher creates a dispatcher delivering messages from the database to a sink.
+func NewDispatcher(database db.DBInterface, sink Sink) *Dispatcher {
+	return &Dispatcher{
+		db:           database,
+		sink:         sink,
+		clock:        clock.System{},
+		pollInterval: pollInterval,
+		batchSize:    batchSize,
+		settleDelay:  settleDelay,
+	}
+}
+
+// Start polls for new messages and delivers them until the context is cancelled.
+func (d *Dispatcher) Start(ctx context.Context) {
+	ticker := time.NewTicker(d.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Keep delivering straight away while there is a backlog, then wait for new messages
+		if d.dispatch(ctx) == d.batchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch delivers the next batch of messages and returns how many were delivered.
+func (d *Dispatcher) dispatch(ctx context.Context) int {
+	ctx, span := tracing.Tracer().Start(ctx, "outbox.dispatch")
+	defer span.End()
+
+	cursor, err := d.db.GetOutboxCursor(d.sink.Name())
+	if err != nil {
+		log.Printf("Failed to get outbox cursor: %v", err)
+		return 0
+	}
+
+	messages, err := d.db.GetMessagesAfter(cursor, d.batchSize)
+	if err != nil {
+		log.Printf("Failed to get messages for %s: %v", d.sink.Name(), err)
+		return 0
+	}
+
+	// IDs sort by time, so the settled messages are a prefix of the batch
+	settled := d.clock.Now().Add(-d.settleDelay)
+	for i, msg := range messages {
+		if snowflake.Time(msg.ID).After(settled) {
+			messages = messages[:i]
+			break
+		}
+	}
+	if len(messages) == 0 {
+		return 0
+	}
+
+	if err := d.sink.Deliver(ctx, messages); err != nil {
+		log.Printf("Failed to deliver %d messages to %s, will retry: %v", len(messages), d.sink.Name(), err)
+		return 0
+	}
+
+	if err := d.db.SetOutboxCursor(d.sink.Name(), messages[len(messages)-1].ID); err != nil {
+		log.Printf("Failed to set outbox cursor, messages will be delivered again: %v", err)
+		return 0
+	}
+	return len(messages)
+}
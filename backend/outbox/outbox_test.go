@@ -0,0 +1,71 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go-chat-app/db"
+	"go-chat-app/models"
+)
+
+type recordingSink struct {
+	fail      bool
+	delivered []models.Message
+}
+
+func (s *recordingSink) Name() string { return "test" }
+
+func (s *recordingSink) Deliver(_ context.Context, messages []models.Message) error {
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+	s.delivered = append(s.delivered, messages...)
+	return nil
+}
+
+func TestDispatch_DeliversInBatchesAndAdvancesCursor(t *testing.T) {
+	mockDB := db.NewMockDB()
+	for _, content := range []string{"one", "two", "three"} {
+		mockDB.SaveMessage(models.Message{TenantID: 1, Sender: "user1", Content: content})
+	}
+
+	sink := &recordingSink{}
+	dispatcher := NewDispatcher(mockDB, sink)
+	dispatcher.batchSize = 2
+
+	if n := dispatcher.dispatch(context.Background()); n != 2 {
+		t.Fatalf("expected first batch of 2, got %d", n)
+	}
+	if n := dispatcher.dispatch(context.Background()); n != 1 {
+		t.Fatalf("expected second batch of 1, got %d", n)
+	}
+	if n := dispatcher.dispatch(context.Background()); n != 0 {
+		t.Fatalf("expected nothing left to deliver, got %d", n)
+	}
+
+	if len(sink.delivered) != 3 || sink.delivered[2].Content != "three" {
+		t.Errorf("expected all messages delivered in order, got %+v", sink.delivered)
+	}
+}
+
+func TestDispatch_RetriesFailedDelivery(t *testing.T) {
+	mockDB := db.NewMockDB()
+	mockDB.SaveMessage(models.Message{TenantID: 1, Sender: "user1", Content: "hello"})
+
+	sink := &recordingSink{fail: true}
+	dispatcher := NewDispatcher(mockDB, sink)
+
+	if n := dispatcher.dispatch(context.Background()); n != 0 {
+		t.Fatalf("expected failed delivery, got %d", n)
+	}
+	if cursor, _ := mockDB.GetOutboxCursor("test"); cursor != 0 {
+		t.Fatalf("expected cursor not to advance after a failure, got %d", cursor)
+	}
+
+	// The same message is delivered once the sink recovers
+	sink.fail = false
+	if n := dispatcher.dispatch(context.Background()); n != 1 || sink.delivered[0].Content != "hello" {
+		t.Fatalf("expected message to be redelivered, got %d %+v", n, sink.delivered)
+	}
+}
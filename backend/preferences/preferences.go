@@ -0,0 +1,108 @@
+package preferences
+
+import (
+	"fmt"
+	"time"
+
+	"go-chat-app/models"
+	"go-chat-app/validation"
+)
+
+// Limits on Do Not Disturb schedules
+const maxDNDWindows = 14
+
+// Default returns the preferences of a user who hasn't set any.
+func Default() models.Preferences {
+	return models.Preferences{TimeZone: "UTC", DoNotDisturb: []models.DNDWindow{}}
+}
+
+// Validate checks a user's preferences, returning an error for each invalid field.
+func Validate(prefs models.Preferences) []validation.FieldError {
+	var errs []validation.FieldError
+
+	if _, err := time.LoadLocation(prefs.TimeZone); err != nil || prefs.TimeZone == "" {
+		errs = append(errs, validation.FieldError{Field: "timeZone", Message: "must be an IANA time zone, e.g. Europe/London"})
+	}
+	if len(prefs.DoNotDisturb) > maxDNDWindows {
+		errs = append(errs, validation.FieldError{Field: "doNotDisturb", Message: fmt.Sprintf("must have at most %d windows", maxDNDWindows)})
+	}
+
+	for i, window := range prefs.DoNotDisturb {
+		field := fmt.Sprintf("doNotDisturb[%d]", i)
+		start, startErr := parseClock(window.Start)
+		end, endErr := parseClock(window.End)
+		if startErr != nil {
+			errs = append(errs, validation.FieldError{Field: field + ".start", Message: "must be a time as HH:MM"})
+		}
+		if endErr != nil {
+			errs = append(errs, validation.FieldError{Field: field + ".end", Message: "must be a time as HH:MM"})
+		}
+		if startErr == nil && endErr == nil && start == end {
+			errs = append(errs, validation.FieldError{Field: field + ".end", Message: "must be different from start"})
+		}
+		for _, day := range window.Days {
+			if day < 0 || day > 6 {
+				errs = append(errs, validation.FieldError{Field: field + ".days", Message: "must be days 0 (Sunday) to 6"})
+				break
+			}
+		}
+	}
+
+	return errs
+}
+
+// InDoNotDisturb reports whether the time falls in one of the user's Do Not Disturb windows.
+// Notifiers (mentions, push, email) check this before sending; messages are still delivered and stay unread.
+func InDoNotDisturb(prefs models.Preferences, now time.Time) bool {
+	location, err := time.LoadLocation(prefs.TimeZone)
+	if err != nil {
+		location = time.UTC
+	}
+	now = now.In(location)
+	minute := now.Hour()*60 + now.Minute()
+	today := now.Weekday()
+	yesterday := now.AddDate(0, 0, -1).Weekday()
+
+	for _, window := range prefs.DoNotDisturb {
+		start, startErr := parseClock(window.Start)
+		end, endErr := parseClock(window.End)
+		if startErr != nil || endErr != nil {
+			continue
+		}
+
+		if start < end {
+			if minute >= start && minute < end && appliesOn(window, today) {
+				return true
+			}
+			continue
+		}
+
+		// Overnight windows apply from the start on the day they start until the end the next day
+		if minute >= start && appliesOn(window, today) || minute < end && appliesOn(window, yesterday) {
+			return true
+		}
+	}
+	return false
+}
+
+// appliesOn reports whether a window starts on the given day.
+func appliesOn(window models.DNDWindow, day time.Weekday) bool {
+	if len(window.Days) == 0 {
+		return true
+	}
+	for _, d := range window.Days {
+		if time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock parses an HH:MM time into minutes since midnight.
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
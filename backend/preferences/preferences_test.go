@@ -0,0 +1,48 @@
+package preferences_test
+
+import (
+	"testing"
+	"time"
+
+	"go-chat-app/models"
+	"go-chat-app/preferences"
+)
+
+func TestInDoNotDisturb_OvernightWindow(t *testing.T) {
+	prefs := models.Preferences{
+		TimeZone:     "Europe/London",
+		DoNotDisturb: []models.DNDWindow{{Start: "22:00", End: "07:00", Days: []int{int(time.Friday)}}},
+	}
+	london, _ := time.LoadLocation("Europe/London")
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{"friday evening before window", time.Date(2024, 6, 7, 21, 59, 0, 0, london), false},
+		{"friday night", time.Date(2024, 6, 7, 23, 0, 0, 0, london), true},
+		{"saturday morning", time.Date(2024, 6, 8, 6, 59, 0, 0, london), true},
+		{"saturday after window", time.Date(2024, 6, 8, 7, 0, 0, 0, london), false},
+		{"thursday night", time.Date(2024, 6, 6, 23, 0, 0, 0, london), false},
+		{"friday night in UTC", time.Date(2024, 6, 7, 21, 30, 0, 0, time.UTC), true}, // 22:30 in London
+	}
+	for _, tt := range tests {
+		if got := preferences.InDoNotDisturb(prefs, tt.at); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := models.Preferences{TimeZone: "UTC", DoNotDisturb: []models.DNDWindow{{Start: "09:00", End: "17:30"}}}
+	if errs := preferences.Validate(valid); len(errs) != 0 {
+		t.Errorf("expected valid preferences, got %+v", errs)
+	}
+
+	invalid := models.Preferences{TimeZone: "Mars/Olympus", DoNotDisturb: []models.DNDWindow{{Start: "9am", End: "17:00", Days: []int{7}}}}
+	errs := preferences.Validate(invalid)
+	if len(errs) != 3 {
+		t.Fatalf("expected time zone, start and days errors, got %+v", errs)
+	}
+}
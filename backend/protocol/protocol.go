@@ -0,0 +1,148 @@
+package protocol
+
+import (
+	"regexp"
+	"slices"
+	"time"
+)
+
+// Capability negotiation. After connecting, a client can send a "hello" frame declaring what it supports, and the
+// server replies with a "welcome" frame containing the agreed feature set. New message types are only sent to
+// clients that agreed to them, so they can be rolled out without breaking older clients.
+// Clients that never send a hello are treated as legacy clients and get LegacyCapabilities.
+
+// Version is the newest protocol version the server speaks.
+const Version = 1
+
+// Frame types
+const (
+	TypeHello       = "hello"
+	TypeWelcome     = "welcome"
+	TypeChat        = "chat"
+	TypeCode        = "code"
+	TypeActiveUsers = "activeUsers"
+	TypeMOTD        = "motd"
+	TypeNotice      = "notice"
+	TypeReaction    = "reaction"
+	TypeStats       = "stats" // Only sent to admins
+)
+
+// BatchingNDJSON sends several frames in one WebSocket message when a client has a backlog, separated by newlines.
+const BatchingNDJSON = "ndjson"
+
+// Compression and binary encodings the server supports, most preferred first
+var (
+	serverCompression = []string{"permessage-deflate"}
+	serverBatching    = []string{BatchingNDJSON}
+	serverEncodings   = []string{"json"}
+	serverTypes       = []string{TypeChat, TypeCode, TypeReaction, TypeActiveUsers, TypeWelcome, TypeStats}
+)
+
+// Frame is used to read the type of an incoming frame before decoding the rest of it.
+// Chat messages predate frame types so have an empty type.
+type Frame struct {
+	Type string `json:"type"`
+}
+
+// Hello is sent by the client to declare its capabilities.
+type Hello struct {
+	Type            string   `json:"type"`
+	ProtocolVersion int      `json:"protocolVersion"`
+	Compression     []string `json:"compression"`
+	BinaryEncodings []string `json:"binaryEncodings"`
+	MessageTypes    []string `json:"messageTypes"`
+	Batching        []string `json:"batching"`
+	Locale          string   `json:"locale"`   // BCP 47 language tag, e.g. en-GB
+	TimeZone        string   `json:"timeZone"` // IANA time zone, e.g. Europe/London
+}
+
+// Capabilities is the feature set agreed with a client, sent back in the welcome frame.
+type Capabilities struct {
+	Type            string   `json:"type"`
+	ProtocolVersion int      `json:"protocolVersion"`
+	Compression     string   `json:"compression"`    // Empty when not compressed
+	BinaryEncoding  string   `json:"binaryEncoding"` // Encoding used for frames, currently always "json"
+	MessageTypes    []string `json:"messageTypes"`
+	Batching        string   `json:"batching"` // Empty when every frame is sent as its own WebSocket message
+	Locale          string   `json:"locale"`   // Used for messages the server writes for this connection
+	TimeZone        string   `json:"timeZone"` // Used for times in messages the server writes for this connection
+}
+
+// Defaults for clients that don't send, or send an invalid, locale or time zone
+const (
+	DefaultLocale   = "en"
+	DefaultTimeZone = "UTC"
+)
+
+// localePattern matches well formed BCP 47 language tags, without checking the subtags are registered
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{1,8})*$`)
+
+// LegacyCapabilities are assumed for clients that don't send a hello frame.
+func LegacyCapabilities() Capabilities {
+	return Capabilities{
+		Type:            TypeWelcome,
+		ProtocolVersion: 0,
+		BinaryEncoding:  "json",
+		MessageTypes:    []string{TypeChat, TypeActiveUsers},
+		Locale:          DefaultLocale,
+		TimeZone:        DefaultTimeZone,
+	}
+}
+
+// Negotiate works out the feature set supported by both the client and the server.
+func Negotiate(hello Hello) Capabilities {
+	agreed := Capabilities{
+		Type:            TypeWelcome,
+		ProtocolVersion: min(hello.ProtocolVersion, Version),
+		Compression:     firstShared(serverCompression, hello.Compression),
+		BinaryEncoding:  firstShared(serverEncodings, hello.BinaryEncodings),
+		Batching:        firstShared(serverBatching, hello.Batching),
+		MessageTypes:    []string{},
+		Locale:          DefaultLocale,
+		TimeZone:        DefaultTimeZone,
+	}
+
+	if localePattern.MatchString(hello.Locale) {
+		agreed.Locale = hello.Locale
+	}
+	if _, err := time.LoadLocation(hello.TimeZone); err == nil && hello.TimeZone != "" {
+		agreed.TimeZone = hello.TimeZone
+	}
+
+	// JSON is always available as the fallback encoding
+	if agreed.BinaryEncoding == "" {
+		agreed.BinaryEncoding = "json"
+	}
+
+	for _, messageType := range serverTypes {
+		if slices.Contains(hello.MessageTypes, messageType) {
+			agreed.MessageTypes = append(agreed.MessageTypes, messageType)
+		}
+	}
+
+	return agreed
+}
+
+// Supports reports whether a message type was agreed.
+func (c Capabilities) Supports(messageType string) bool {
+	return slices.Contains(c.MessageTypes, messageType)
+}
+
+// Location returns the agreed time zone, falling back to UTC.
+func (c Capabilities) Location() *time.Location {
+	location, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// firstShared returns the first of the server's options that the client also supports.
+func firstShared(server, client []string) string {
+	for _, option := range server {
+		if slices.Contains(client, option) {
+			return option
+		}
+	}
+	return ""
+}
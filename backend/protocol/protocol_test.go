@@ -0,0 +1,58 @@
+package protocol_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"go-chat-app/protocol"
+)
+
+func TestNegotiate(t *testing.T) {
+	agreed := protocol.Negotiate(protocol.Hello{
+		Type:            protocol.TypeHello,
+		ProtocolVersion: 5,
+		Compression:     []string{"gzip", "permessage-deflate"},
+		BinaryEncodings: []string{"msgpack"},
+		MessageTypes:    []string{protocol.TypeChat, "futureType"},
+		Batching:        []string{"cbor-seq", protocol.BatchingNDJSON},
+	})
+
+	if agreed.ProtocolVersion != protocol.Version {
+		t.Errorf("expected protocol version %d, got %d", protocol.Version, agreed.ProtocolVersion)
+	}
+	if agreed.Compression != "permessage-deflate" {
+		t.Errorf("expected permessage-deflate compression, got %q", agreed.Compression)
+	}
+	if agreed.BinaryEncoding != "json" {
+		t.Errorf("expected fallback to json encoding, got %q", agreed.BinaryEncoding)
+	}
+	if agreed.Batching != protocol.BatchingNDJSON {
+		t.Errorf("expected ndjson batching, got %q", agreed.Batching)
+	}
+	if !slices.Equal(agreed.MessageTypes, []string{protocol.TypeChat}) {
+		t.Errorf("expected only chat to be agreed, got %v", agreed.MessageTypes)
+	}
+	if agreed.Supports(protocol.TypeActiveUsers) {
+		t.Error("expected activeUsers not to be supported")
+	}
+}
+
+func TestNegotiate_LocaleAndTimeZone(t *testing.T) {
+	agreed := protocol.Negotiate(protocol.Hello{Locale: "en-US", TimeZone: "America/New_York"})
+	if agreed.Locale != "en-US" || agreed.TimeZone != "America/New_York" {
+		t.Errorf("expected en-US in America/New_York, got %q in %q", agreed.Locale, agreed.TimeZone)
+	}
+	if agreed.Location().String() != "America/New_York" {
+		t.Errorf("expected America/New_York location, got %s", agreed.Location())
+	}
+
+	// Invalid values fall back to the defaults rather than failing the handshake
+	agreed = protocol.Negotiate(protocol.Hello{Locale: "not a locale", TimeZone: "Mars/Olympus_Mons"})
+	if agreed.Locale != protocol.DefaultLocale || agreed.TimeZone != protocol.DefaultTimeZone {
+		t.Errorf("expected default locale and time zone, got %q in %q", agreed.Locale, agreed.TimeZone)
+	}
+	if agreed.Location() != time.UTC {
+		t.Errorf("expected UTC location, got %s", agreed.Location())
+	}
+}
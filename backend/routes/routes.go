@@ -2,21 +2,69 @@ package routes
 
 import (
 	"net/http"
+	"time"
 
 	"go-chat-app/handlers"
 	"go-chat-app/middleware"
 	"go-chat-app/services"
+	"go-chat-app/tenants"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 func SetupRoutes(services *services.Services) {
-	corsMiddleware := middleware.CORSMiddleware()
+	cors := middleware.CORSMiddleware(services.Origins)
+	tenantMiddleware := tenants.Middleware(services.DB)
+
+	// Every route resolves its tenant after CORS so preflight requests don't need one
+	withMiddleware := func(next http.Handler) http.Handler {
+		return cors(tenantMiddleware(next))
+	}
+
+	// handleWithLimits registers a traced REST route with request limits and panic recovery, using the route pattern as the span name
+	handleWithLimits := func(pattern string, handler http.HandlerFunc, limits middleware.Limits) {
+		http.Handle(pattern, otelhttp.NewHandler(middleware.Recover(middleware.WithLimits(limits)(withMiddleware(handler))), pattern))
+	}
+
+	// handle registers a traced REST route with the default request limits
+	handle := func(pattern string, handler http.HandlerFunc) {
+		handleWithLimits(pattern, handler, middleware.DefaultLimits)
+	}
+
+	// compressed compresses a route's responses, for routes that can return large bodies
+	compressed := func(handler http.HandlerFunc) http.HandlerFunc {
+		return middleware.Compress(handler).ServeHTTP
+	}
+
+	handle("/history", compressed(handlers.ChatHistoryHandler(services)))
+	handle("/history/archives", compressed(handlers.ArchivesHandler(services)))
+	handle("/history/archives/{id}", compressed(handlers.ArchivePageHandler(services)))
+	// Transcripts can read archived pages from cold storage and send email, so get longer
+	handleWithLimits("/history/transcript", handlers.TranscriptHandler(services), middleware.Limits{Timeout: 2 * time.Minute, MaxBodyBytes: 1 << 10})
+	http.Handle("/ws", middleware.Recover(services.Affinity.Middleware(withMiddleware(http.HandlerFunc(handlers.HandleConnections(services)))))) // Not traced or time limited as a whole, both would last the connection's lifetime
+	handle("/motd", handlers.MOTDHandler(services))
+	handle("/events", handlers.EventsHandler(services))
+	handle("/events/{id}", handlers.CancelEventHandler(services))
+
+	handleWithLimits("/webhooks/messages", handlers.WebhookMessagesHandler(services), middleware.Limits{Timeout: 10 * time.Second, MaxBodyBytes: 64 << 10})
+
+	handle("/presence", handlers.PresenceHandler(services))
+	handle("/users/{username}", handlers.UserHandler(services))
+	handle("/preferences", handlers.PreferencesHandler(services))
+	handle("/display-name", handlers.DisplayNameHandler(services))
+	handle("/email", handlers.EmailHandler(services))
 
-	http.Handle("/history", corsMiddleware(http.HandlerFunc(handlers.ChatHistoryHandler(services))))
-	http.Handle("/ws", corsMiddleware(http.HandlerFunc(handlers.HandleConnections(services))))
+	handle("/admin/connections", handlers.AdminConnectionsHandler(services))
+	handle("/admin/connections/{id}", handlers.AdminConnectionHandler(services))
+	handle("/admin/motd", handlers.AdminMOTDHandler(services))
+	handle("/admin/feature-flags", handlers.AdminFeatureFlagsHandler(services))
+	handle("/admin/feature-flags/{name}", handlers.AdminFeatureFlagHandler(services))
+	handle("/admin/users/{username}/deactivation", handlers.AdminUserDeactivationHandler(services))
 
-	http.Handle("/register", corsMiddleware(http.HandlerFunc(services.Auth.Register)))
-	http.Handle("/login", corsMiddleware(http.HandlerFunc(services.Auth.LoginUser)))
-	http.Handle("/logout", corsMiddleware(http.HandlerFunc(services.Auth.LogoutUser)))
-	http.Handle("/session-check", corsMiddleware(http.HandlerFunc(services.Auth.SessionCheck)))
-	http.Handle("/profile", corsMiddleware(http.HandlerFunc(services.Auth.Profile))) // Not used by frontend, just for test/demonstration purposes
+	handle("/register", services.Auth.Register)
+	handle("/login", services.Auth.LoginUser)
+	handle("/logout", services.Auth.LogoutUser)
+	handle("/account/deactivate", services.Auth.DeactivateAccount)
+	handle("/session-check", services.Auth.SessionCheck)
+	handle("/profile", services.Auth.Profile) // Not used by frontend, just for test/demonstration purposes
 }
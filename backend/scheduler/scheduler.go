@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"go-chat-app/broadcast"
+	"go-chat-app/db"
+	"go-chat-app/models"
+	"go-chat-app/snowflake"
+	"go-chat-app/tracing"
+)
+
+// How often the scheduler checks for events that are due
+const checkInterval = 30 * time.Second
+
+// StartEventScheduler periodically announces scheduled events in the chat when they start,
+// plus a reminder a configurable number of minutes (EVENT_REMINDER_MINUTES, default 10) beforehand.
+func StartEventScheduler(database db.DBInterface, messageIDs *snowflake.Generator) {
+	lead := reminderLead()
+	announce := func(ctx context.Context, msg models.Message) {
+		msg.ID = messageIDs.Next()
+		broadcast.BroadcastMessage(ctx, msg)
+	}
+
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		processEvents(context.Background(), database, time.Now(), lead, announce)
+	}
+}
+
+// processEvents sends any reminders and announcements that are due at the given time.
+func processEvents(ctx context.Context, database db.DBInterface, now time.Time, lead time.Duration, announce func(context.Context, models.Message)) {
+	ctx, span := tracing.Tracer().Start(ctx, "scheduler.processEvents")
+	defer span.End()
+
+	events, err := database.GetPendingEvents(now.Add(lead))
+	if err != nil {
+		log.Printf("Failed to get pending events: %v", err)
+		return
+	}
+
+	for _, event := range events {
+		switch {
+		case !event.StartsAt.After(now):
+			announce(ctx, systemMessage(event, fmt.Sprintf("Event starting now: %s", event.Title), now))
+			if err := database.MarkEventAnnounced(event.ID); err != nil {
+				log.Printf("Failed to mark event announced: %v", err)
+			}
+
+		case !event.Reminded:
+			minutes := int(event.StartsAt.Sub(now).Round(time.Minute).Minutes())
+			announce(ctx, systemMessage(event, fmt.Sprintf("Reminder: %s starts in %d minutes", event.Title, minutes), now))
+			if err := database.MarkEventReminded(event.ID); err != nil {
+				log.Printf("Failed to mark event reminded: %v", err)
+			}
+		}
+	}
+}
+
+func systemMessage(event models.Event, content string, now time.Time) models.Message {
+	return models.Message{
+		TenantID:  event.TenantID,
+		Sender:    "System",
+		Content:   content,
+		Timestamp: now,
+	}
+}
+
+// reminderLead reads how long before an event its reminder is sent
+func reminderLead() time.Duration {
+	minutes, err := strconv.Atoi(os.Getenv("EVENT_REMINDER_MINUTES"))
+	if err != nil || minutes < 0 {
+		minutes = 10
+	}
+	return time.Duration(minutes) * time.Minute
+}
@@ -0,0 +1,56 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go-chat-app/db"
+	"go-chat-app/models"
+)
+
+func TestProcessEvents_RemindsThenAnnounces(t *testing.T) {
+	mockDB := db.NewMockDB()
+	now := time.Now()
+	mockDB.SaveEvent(models.Event{TenantID: 1, Title: "Standup", StartsAt: now.Add(5 * time.Minute)})
+
+	var sent []models.Message
+	announce := func(_ context.Context, msg models.Message) { sent = append(sent, msg) }
+
+	// Within the reminder window but not started yet
+	processEvents(context.Background(), mockDB, now, 10*time.Minute, announce)
+	if len(sent) != 1 || sent[0].Content != "Reminder: Standup starts in 5 minutes" {
+		t.Fatalf("expected one reminder, got %+v", sent)
+	}
+
+	// The reminder is only sent once
+	processEvents(context.Background(), mockDB, now.Add(time.Minute), 10*time.Minute, announce)
+	if len(sent) != 1 {
+		t.Fatalf("expected reminder to be sent once, got %d messages", len(sent))
+	}
+
+	// Announced when the event starts, and then no longer pending
+	processEvents(context.Background(), mockDB, now.Add(5*time.Minute), 10*time.Minute, announce)
+	if len(sent) != 2 || sent[1].Content != "Event starting now: Standup" {
+		t.Fatalf("expected announcement, got %+v", sent)
+	}
+
+	upcoming, _ := mockDB.GetUpcomingEvents(1)
+	if len(upcoming) != 0 {
+		t.Errorf("expected no upcoming events, got %d", len(upcoming))
+	}
+}
+
+func TestProcessEvents_CancelledEventNotAnnounced(t *testing.T) {
+	mockDB := db.NewMockDB()
+	now := time.Now()
+	id, _ := mockDB.SaveEvent(models.Event{TenantID: 1, Title: "Standup", StartsAt: now})
+	mockDB.CancelEvent(1, id)
+
+	var sent []models.Message
+	processEvents(context.Background(), mockDB, now, 10*time.Minute, func(_ context.Context, msg models.Message) { sent = append(sent, msg) })
+
+	if len(sent) != 0 {
+		t.Errorf("expected no messages for a cancelled event, got %d", len(sent))
+	}
+}
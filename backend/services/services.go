@@ -1,8 +1,23 @@
 package services
 
 import (
+	"context"
+	"go-chat-app/affinity"
+	"go-chat-app/analytics"
+	"go-chat-app/archive"
 	"go-chat-app/auth"
+	"go-chat-app/backoff"
+	"go-chat-app/clock"
 	"go-chat-app/db"
+	"go-chat-app/embedding"
+	"go-chat-app/featureflags"
+	"go-chat-app/flood"
+	"go-chat-app/guests"
+	"go-chat-app/ids"
+	"go-chat-app/mailer"
+	"go-chat-app/origins"
+	"go-chat-app/snowflake"
+	"go-chat-app/usernames"
 	"log"
 	"os"
 
@@ -10,8 +25,28 @@ import (
 )
 
 type Services struct {
-	DB   db.DBInterface
-	Auth auth.AuthServiceInterface
+	DB       db.DBInterface
+	Auth     auth.AuthServiceInterface
+	Embed    *embedding.Config
+	Affinity *affinity.Config
+	Archive  archive.Store // Cold storage for old messages, nil if archiving isn't configured
+	Guests   *guests.Config
+	Origins  *origins.Policy
+	Flood    flood.Config   // Inbound WebSocket frame rate limit per connection
+	Backoff  backoff.Config // Connection capacity, and the reconnect guidance derived from load
+
+	UsernameRules usernames.Rules // Also applied to display names
+	Flags         *featureflags.Flags
+
+	Analytics *analytics.Pipeline // Nil if analytics are off
+
+	Clock clock.Clock   // Used instead of time.Now so tests can control the time
+	IDs   ids.Generator // Used instead of uuid.New so tests get predictable IDs
+
+	MessageIDs *snowflake.Generator // Assigns message IDs at intake
+
+	Mailer          mailer.Mailer // Nil if email isn't configured
+	ComplianceEmail string        // Address admins can have transcripts sent to, empty if not configured
 }
 
 // InitialiseServices initialises database and auth services
@@ -38,12 +73,91 @@ func InitialiseServices() (*db.MySQLDB, *Services) {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	// Load embed mode config. Embedding in third-party iframes needs SameSite=None cookies
+	embedConfig := embedding.LoadConfig()
+	sameSite := auth.ParseSameSite(os.Getenv("COOKIE_SAMESITE"))
+	if embedConfig.Enabled() && os.Getenv("COOKIE_SAMESITE") == "" {
+		sameSite = auth.ParseSameSite("none")
+	}
+
+	usernameRules, err := usernames.LoadRules()
+	if err != nil {
+		log.Fatalf("Failed to load username rules: %v", err)
+	}
+
+	flagDefaults, err := featureflags.LoadDefaults()
+	if err != nil {
+		log.Fatalf("Failed to load feature flag defaults: %v", err)
+	}
+
+	// Stop anyone registering a name that could be mistaken for a guest
+	guestConfig := guests.LoadConfig()
+	if guestConfig.Enabled {
+		usernameRules.GuestPrefix = guestConfig.Prefix
+	}
+
+	// Load sticky session config for load balanced deployments
+	affinityConfig := affinity.LoadConfig()
+	affinityConfig.SameSite = sameSite
+
+	// Load the product analytics pipeline
+	analyticsPipeline, err := analytics.Load()
+	if err != nil {
+		log.Fatalf("Failed to load analytics config: %v", err)
+	}
+
 	// Initialize the auth service
-	authService := auth.NewAuthService(mySQLDB)
+	authService := auth.NewAuthService(mySQLDB,
+		auth.WithSameSite(sameSite),
+		auth.WithUsernameRules(usernameRules),
+		auth.WithAffinity(affinityConfig),
+		auth.WithAnalytics(analyticsPipeline),
+	)
 
 	services := &Services{
-		DB:   mySQLDB,
-		Auth: authService,
+		DB:       mySQLDB,
+		Auth:     authService,
+		Embed:    embedConfig,
+		Affinity: affinityConfig,
+		Guests:   guestConfig,
+		Origins:  origins.LoadPolicy(),
+		Flood:    flood.LoadConfig(),
+		Backoff:  backoff.LoadConfig(),
+
+		UsernameRules: usernameRules,
+		Flags:         featureflags.New(mySQLDB, flagDefaults),
+
+		Analytics: analyticsPipeline,
+
+		Clock: clock.System{},
+		IDs:   ids.UUID{},
+
+		ComplianceEmail: os.Getenv("TRANSCRIPT_COMPLIANCE_EMAIL"),
+	}
+
+	// Message IDs are generated here rather than by the database, so each instance needs its own node
+	messageIDs, err := snowflake.Load(services.Clock)
+	if err != nil {
+		log.Fatalf("Failed to load message ID generator: %v", err)
+	}
+	services.MessageIDs = messageIDs
+
+	// Load the SMTP relay for outgoing email
+	smtpMailer, err := mailer.LoadSMTP()
+	if err != nil {
+		log.Fatalf("Failed to load mailer config: %v", err)
+	}
+	if smtpMailer != nil {
+		services.Mailer = smtpMailer
+	}
+
+	// Load cold storage for archived messages
+	archiveStore, err := archive.LoadS3Store(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to initialise message archive: %v", err)
+	}
+	if archiveStore != nil {
+		services.Archive = archiveStore
 	}
 	return mySQLDB, services
 }
@@ -0,0 +1,75 @@
+package tenants
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+
+	"go-chat-app/apierror"
+	"go-chat-app/db"
+	"go-chat-app/models"
+)
+
+// A single deployment can host isolated chat instances for multiple tenants (customers).
+// Each request is resolved to a tenant, either by API key (for bots and integrations) or by the hostname it was sent to.
+// Requests that don't match any tenant fall back to the default tenant so single tenant deployments need no config.
+
+// DefaultTenantID is the tenant created by init.sql and used when no other tenant matches.
+const DefaultTenantID = 1
+
+type contextKey struct{}
+
+// Resolve works out which tenant a request belongs to.
+func Resolve(database db.DBInterface, r *http.Request) (models.Tenant, error) {
+	// An explicit API key takes priority and must be valid if given
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		return database.GetTenantByAPIKey(apiKey)
+	}
+
+	hostname := r.Host
+	if host, _, err := net.SplitHostPort(r.Host); err == nil {
+		hostname = host
+	}
+
+	tenant, err := database.GetTenantByHostname(hostname)
+	if err != nil {
+		return models.Tenant{ID: DefaultTenantID}, nil
+	}
+	return tenant, nil
+}
+
+// Middleware resolves the tenant for each request and stores it in the request context.
+func Middleware(database db.DBInterface) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tenant, err := Resolve(database, r)
+			if err != nil {
+				log.Printf("Tenant resolution failed for host %s: %v", r.Host, err)
+				apierror.Write(w, http.StatusUnauthorized, apierror.CodeUnknownTenant, "Unknown tenant")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), tenant)))
+		})
+	}
+}
+
+// NewContext returns a copy of ctx carrying the tenant.
+func NewContext(ctx context.Context, tenant models.Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenant)
+}
+
+// FromContext returns the tenant stored in ctx, reporting false if none has been resolved.
+func FromContext(ctx context.Context) (models.Tenant, bool) {
+	tenant, ok := ctx.Value(contextKey{}).(models.Tenant)
+	return tenant, ok
+}
+
+// IDFromContext returns the tenant ID stored in ctx, or the default tenant if none has been resolved.
+func IDFromContext(ctx context.Context) int {
+	if tenant, ok := ctx.Value(contextKey{}).(models.Tenant); ok {
+		return tenant.ID
+	}
+	return DefaultTenantID
+}
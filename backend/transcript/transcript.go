@@ -0,0 +1,104 @@
+package transcript
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"sort"
+	"time"
+
+	"go-chat-app/archive"
+	"go-chat-app/db"
+	"go-chat-app/models"
+	"go-chat-app/protocol"
+)
+
+// A transcript is every message sent in a tenant's chat on one calendar day, rendered as HTML for email.
+// Messages older than the archive cutoff have been moved to cold storage, so they are read back from the archived pages
+// covering the day as well as from the database.
+
+// Day returns the start and end of the calendar day containing t, in t's location.
+func Day(t time.Time) (time.Time, time.Time) {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 0, 1)
+}
+
+// Messages gets a tenant's messages sent between from (inclusive) and to (exclusive), oldest first.
+// store may be nil if archiving isn't configured.
+func Messages(ctx context.Context, database db.DBInterface, store archive.Store, tenantID int, from, to time.Time) ([]models.Message, error) {
+	messages, err := database.GetMessagesBetween(tenantID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	if store != nil {
+		pages, err := database.GetMessageArchives(tenantID)
+		if err != nil {
+			return nil, err
+		}
+		for _, page := range pages {
+			if !page.From.Before(to) || page.To.Before(from) {
+				continue
+			}
+			archived, err := archive.FetchPage(ctx, store, page)
+			if err != nil {
+				return nil, err
+			}
+			for _, msg := range archived {
+				if !msg.Timestamp.Before(from) && msg.Timestamp.Before(to) {
+					messages = append(messages, msg)
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].Timestamp.Before(messages[j].Timestamp) })
+	return messages, nil
+}
+
+var page = template.Must(template.New("transcript").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif">
+<h1>{{.Title}}</h1>
+{{if not .Messages}}<p>No messages were sent on this day.</p>{{end}}
+<table cellpadding="4">
+{{range .Messages}}<tr>
+<td style="color: #666; white-space: nowrap; vertical-align: top">{{.Time}}</td>
+<td style="font-weight: bold; vertical-align: top">{{.Sender}}</td>
+<td>{{if .Code}}<pre>{{.Content}}</pre>{{else}}{{.Content}}{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+type line struct {
+	Time    string
+	Sender  string
+	Content string
+	Code    bool
+}
+
+// Render renders a day's messages as an HTML document, showing times in the given location.
+// Content is escaped, code snippets are shown as their raw source.
+func Render(title string, messages []models.Message, location *time.Location) (string, error) {
+	lines := make([]line, len(messages))
+	for i, msg := range messages {
+		lines[i] = line{
+			Time:    msg.Timestamp.In(location).Format("15:04"),
+			Sender:  msg.Sender,
+			Content: msg.Content,
+			Code:    msg.Type == protocol.TypeCode,
+		}
+	}
+
+	var b bytes.Buffer
+	if err := page.Execute(&b, struct {
+		Title    string
+		Messages []line
+	}{title, lines}); err != nil {
+		return "", fmt.Errorf("failed to render transcript: %w", err)
+	}
+	return b.String(), nil
+}
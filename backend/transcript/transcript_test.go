@@ -0,0 +1,66 @@
+package transcript_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go-chat-app/archive"
+	"go-chat-app/db"
+	"go-chat-app/models"
+	"go-chat-app/transcript"
+)
+
+type memoryStore map[string][]byte
+
+func (s memoryStore) Put(_ context.Context, key string, data []byte) error {
+	s[key] = data
+	return nil
+}
+
+func (s memoryStore) Get(_ context.Context, key string) ([]byte, error) {
+	return s[key], nil
+}
+
+func TestMessages_IncludesArchivedPages(t *testing.T) {
+	mockDB := db.NewMockDB()
+	store := memoryStore{}
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	from, to := transcript.Day(day.Add(15 * time.Hour))
+
+	// Morning messages were archived, the evening one is still in the database
+	archived := []models.Message{
+		{Sender: "user1", Content: "night before", Timestamp: day.Add(-time.Hour)},
+		{Sender: "user1", Content: "morning", Timestamp: day.Add(9 * time.Hour)},
+	}
+	data, _ := archive.Encode(archived)
+	store.Put(context.Background(), "page", data)
+	mockDB.SaveMessageArchive(models.MessageArchive{TenantID: 1, ObjectKey: "page", From: archived[0].Timestamp, To: archived[1].Timestamp})
+	mockDB.SaveMessage(models.Message{TenantID: 1, Sender: "user2", Content: "evening", Timestamp: day.Add(20 * time.Hour)})
+	mockDB.SaveMessage(models.Message{TenantID: 1, Sender: "user2", Content: "next day", Timestamp: day.Add(25 * time.Hour)})
+
+	messages, err := transcript.Messages(context.Background(), mockDB, store, 1, from, to)
+	if err != nil {
+		t.Fatalf("Messages failed: %v", err)
+	}
+	if len(messages) != 2 || messages[0].Content != "morning" || messages[1].Content != "evening" {
+		t.Errorf("expected the morning and evening messages in order, got %+v", messages)
+	}
+}
+
+func TestRender_EscapesContent(t *testing.T) {
+	london, _ := time.LoadLocation("Europe/London")
+	messages := []models.Message{{Sender: "user1", Content: "<script>alert(1)</script>", Timestamp: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)}}
+
+	html, err := transcript.Render("Transcript", messages, london)
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if strings.Contains(html, "<script>") {
+		t.Error("expected message content to be escaped")
+	}
+	if !strings.Contains(html, "10:30") {
+		t.Errorf("expected the time in the given location, got %s", html)
+	}
+}
@@ -0,0 +1,49 @@
+package usernames
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Names that look the same but use different characters, e.g. a Cyrillic "а" in place of a Latin "a", or "rn" in
+// place of "m", can be used to impersonate other users. Skeleton reduces a name to a form where lookalikes are equal,
+// following the skeleton algorithm of Unicode TR39 with a subset of its confusables table covering the scripts and
+// characters most often used for impersonation.
+
+// confusables maps lowercase characters to the Latin letter or digit they are commonly mistaken for.
+// Names are compared case-insensitively, so "l", "1" and "I" (lowercased to "i") all map to "i".
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'i', 'ї': 'i', 'ј': 'j', 'к': 'k', 'ӏ': 'i', 'м': 'm',
+	'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'ү': 'y', 'х': 'x', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q',
+	'ԝ': 'w',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'μ': 'u', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't',
+	'υ': 'u', 'χ': 'x', 'ζ': 'z',
+	// Latin lookalikes, digits and punctuation
+	'l': 'i', '1': 'i', '|': 'i', 'ı': 'i', 'ł': 'i', '0': 'o', '5': 's', 'ø': 'o', 'đ': 'd', 'ħ': 'h',
+	'_': '-', '‐': '-', '‑': '-', '‒': '-', '–': '-', '—': '-', '−': '-',
+}
+
+// confusableSequences are multi-character lookalikes, applied after single characters are mapped.
+var confusableSequences = strings.NewReplacer("rn", "m", "vv", "w")
+
+// Skeleton returns a form of a name in which confusable names are equal, so two names are lookalikes if their
+// skeletons match. Case, accents, invisible characters and spacing are ignored.
+func Skeleton(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(Normalize(name)) {
+		switch {
+		case unicode.Is(unicode.Mn, r), unicode.Is(unicode.Cf, r), unicode.IsSpace(r):
+			continue // Accents, zero width characters and spaces
+		}
+		r = unicode.ToLower(r)
+		if mapped, ok := confusables[r]; ok {
+			r = mapped
+		}
+		b.WriteRune(r)
+	}
+	return confusableSequences.Replace(b.String())
+}
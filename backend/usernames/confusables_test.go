@@ -0,0 +1,50 @@
+package usernames_test
+
+import (
+	"testing"
+
+	"go-chat-app/usernames"
+)
+
+func TestSkeleton(t *testing.T) {
+	lookalikes := [][2]string{
+		{"admin", "аdmin"},        // Cyrillic а
+		{"alice", "ALICE"},        // Case
+		{"alice", "ａｌｉｃｅ"},        // Full width
+		{"bill", "biII"},          // Capital I for l
+		{"bill", "bi11"},          // Digit 1 for l
+		{"modern", "modem"},       // rn for m
+		{"zoe", "zoë"},            // Accent
+		{"bob smith", "bobsmith"}, // Spacing
+		{"bob", "b​ob"},           // Zero width space
+		{"peter", "рeтer"},        // Cyrillic р and т
+	}
+	for _, pair := range lookalikes {
+		if usernames.Skeleton(pair[0]) != usernames.Skeleton(pair[1]) {
+			t.Errorf("expected %q and %q to be lookalikes, got skeletons %q and %q",
+				pair[0], pair[1], usernames.Skeleton(pair[0]), usernames.Skeleton(pair[1]))
+		}
+	}
+
+	distinct := [][2]string{{"alice", "alicia"}, {"bill", "bell"}, {"admin", "adrian"}}
+	for _, pair := range distinct {
+		if usernames.Skeleton(pair[0]) == usernames.Skeleton(pair[1]) {
+			t.Errorf("expected %q and %q not to be lookalikes", pair[0], pair[1])
+		}
+	}
+}
+
+func TestValidateDisplayName(t *testing.T) {
+	rules := usernames.DefaultRules()
+
+	for _, name := range []string{"Alice Smith", "O'Brien", "Zoë"} {
+		if message, ok := rules.ValidateDisplayName(name); !ok {
+			t.Errorf("expected %q to be valid, got %q", name, message)
+		}
+	}
+	for _, name := range []string{"", "two  spaces", " leading", "<script>", "Аdmin"} {
+		if _, ok := rules.ValidateDisplayName(name); ok {
+			t.Errorf("expected %q to be invalid", name)
+		}
+	}
+}
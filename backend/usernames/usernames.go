@@ -0,0 +1,141 @@
+package usernames
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Usernames are NFKC normalised before they are validated or stored, so different unicode encodings of what looks
+// like the same name (e.g. a precomposed "é" vs "e" + combining accent, or full width letters) end up identical.
+// Uniqueness is case-insensitive, so "Alice" and "alice" can't both register.
+
+// DefaultReserved are the usernames that can't be registered unless USERNAME_RESERVED overrides them.
+var DefaultReserved = []string{"admin", "administrator", "system", "root", "moderator", "support", "anonymous"}
+
+// Rules are the configurable username rules.
+type Rules struct {
+	Pattern   *regexp.Regexp
+	MinLength int
+	MaxLength int
+	Reserved  map[string]bool // Keyed by Skeleton(username), so lookalikes of reserved names are reserved too
+
+	// GuestPrefix reserves generated guest names, e.g. "Anonymous-1234", when guests are allowed.
+	// Empty when guests aren't allowed.
+	GuestPrefix string
+}
+
+// DefaultRules allows 1-32 letters, numbers, underscores, dots and dashes from any script.
+func DefaultRules() Rules {
+	return Rules{
+		Pattern:   regexp.MustCompile(`^[\p{L}\p{N}_.-]+$`),
+		MinLength: 1,
+		MaxLength: 32,
+		Reserved:  reservedSet(DefaultReserved),
+	}
+}
+
+// LoadRules reads username rules from the environment, falling back to the defaults:
+// USERNAME_PATTERN (regex), USERNAME_MIN_LENGTH, USERNAME_MAX_LENGTH and USERNAME_RESERVED (comma separated).
+func LoadRules() (Rules, error) {
+	rules := DefaultRules()
+
+	if pattern := os.Getenv("USERNAME_PATTERN"); pattern != "" {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return Rules{}, fmt.Errorf("invalid USERNAME_PATTERN: %w", err)
+		}
+		rules.Pattern = compiled
+	}
+	if min, err := strconv.Atoi(os.Getenv("USERNAME_MIN_LENGTH")); err == nil && min > 0 {
+		rules.MinLength = min
+	}
+	if max, err := strconv.Atoi(os.Getenv("USERNAME_MAX_LENGTH")); err == nil && max > 0 {
+		rules.MaxLength = max
+	}
+	if reserved, ok := os.LookupEnv("USERNAME_RESERVED"); ok {
+		rules.Reserved = reservedSet(strings.Split(reserved, ","))
+	}
+
+	return rules, nil
+}
+
+// Validate checks a normalised username against the rules, returning a message describing the first problem found.
+func (r Rules) Validate(username string) (string, bool) {
+	length := utf8.RuneCountInString(username)
+	switch {
+	case length < r.MinLength:
+		return fmt.Sprintf("must be at least %d characters", r.MinLength), false
+	case length > r.MaxLength:
+		return fmt.Sprintf("must be at most %d characters", r.MaxLength), false
+	case !r.Pattern.MatchString(username):
+		return "contains characters that aren't allowed", false
+	case r.Reserved[Skeleton(username)]:
+		return "is reserved", false
+	case r.GuestPrefix != "" && IsGuestName(r.GuestPrefix, username):
+		return "is reserved for guests", false
+	}
+	return "", true
+}
+
+// displayNamePattern allows single spaces and apostrophes in display names, which usernames don't allow
+var displayNamePattern = regexp.MustCompile(`^[\p{L}\p{M}\p{N}_.'-]+( [\p{L}\p{M}\p{N}_.'-]+)*$`)
+
+// ValidateDisplayName checks a normalised display name, returning a message describing the first problem found.
+// Lookalikes of other members' names are checked separately, as that needs the tenant's members.
+func (r Rules) ValidateDisplayName(displayName string) (string, bool) {
+	length := utf8.RuneCountInString(displayName)
+	switch {
+	case length < 1:
+		return "must not be empty", false
+	case length > r.MaxLength:
+		return fmt.Sprintf("must be at most %d characters", r.MaxLength), false
+	case !displayNamePattern.MatchString(displayName):
+		return "contains characters that aren't allowed", false
+	case r.Reserved[Skeleton(displayName)]:
+		return "is reserved", false
+	case r.GuestPrefix != "" && IsGuestName(r.GuestPrefix, displayName):
+		return "is reserved for guests", false
+	}
+	return "", true
+}
+
+// Normalize applies NFKC normalisation and trims surrounding whitespace.
+func Normalize(username string) string {
+	return strings.TrimSpace(norm.NFKC.String(username))
+}
+
+// Key returns the case-insensitive form of a username used for uniqueness checks and lookups.
+func Key(username string) string {
+	return strings.ToLower(Normalize(username))
+}
+
+// GuestName builds a guest display name from a prefix and number, e.g. "Anonymous-1234".
+func GuestName(prefix string, n int) string {
+	return fmt.Sprintf("%s-%d", prefix, n)
+}
+
+// IsGuestName reports whether a username has the form of a guest name with the given prefix.
+func IsGuestName(prefix, username string) bool {
+	number, ok := strings.CutPrefix(Key(username), Key(prefix)+"-")
+	if !ok || number == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(number, 10, 64)
+	return err == nil
+}
+
+func reservedSet(names []string) map[string]bool {
+	reserved := make(map[string]bool)
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			reserved[Skeleton(name)] = true
+		}
+	}
+	return reserved
+}
@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go-chat-app/models"
+	"go-chat-app/protocol"
+
+	"github.com/gorilla/websocket"
+)
+
+// Active clients are spread over shards keyed by a hash of the client ID, each with its own lock, so fan-out only
+// locks one shard at a time and connection storms don't all contend on a single mutex.
+
+// clientShardCount is the number of shards. A power of two keeps the hash to shard mapping cheap.
+const clientShardCount = 32
+
+type clientShard struct {
+	mu      sync.RWMutex
+	clients map[string]*models.Client // keyed by client ID
+}
+
+var clientShards = newClientShards()
+
+func newClientShards() *[clientShardCount]clientShard {
+	shards := &[clientShardCount]clientShard{}
+	for i := range shards {
+		shards[i].clients = make(map[string]*models.Client)
+	}
+	return shards
+}
+
+// shardFor returns the shard a client ID belongs to.
+func shardFor(id string) *clientShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &clientShards[h.Sum32()&(clientShardCount-1)]
+}
+
+// RegisterClient adds a client to the active client pool.
+func RegisterClient(client *models.Client) {
+	addClient(client)
+	notifyClients <- struct{}{}
+}
+
+// DeregisterClient removes a client from the active client pool. Deregistering a client more than once is harmless.
+func DeregisterClient(client *models.Client) {
+	if removeClient(client) {
+		notifyClients <- struct{}{}
+	}
+}
+
+func addClient(client *models.Client) {
+	shard := shardFor(client.ID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	shard.clients[client.ID] = client
+}
+
+// removeClient removes a client, reporting whether it was registered.
+func removeClient(client *models.Client) bool {
+	shard := shardFor(client.ID)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	if _, ok := shard.clients[client.ID]; !ok {
+		return false
+	}
+	delete(shard.clients, client.ID)
+	return true
+}
+
+// ForEachClient calls fn for every active client, one shard at a time.
+// fn runs with the shard locked so must not register or deregister clients; collect them and do it afterwards.
+func ForEachClient(fn func(client *models.Client)) {
+	for i := range clientShards {
+		clientShards[i].forEach(fn)
+	}
+}
+
+// forEach calls fn for every client in the shard. The lock is released by a defer so a panic in fn, once recovered,
+// doesn't leave the shard locked.
+func (shard *clientShard) forEach(fn func(client *models.Client)) {
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	for _, client := range shard.clients {
+		fn(client)
+	}
+}
+
+// CollectActiveUsers returns a list of display names of active clients, grouped by tenant ID.
+func CollectActiveUsers() map[int][]string {
+	users := make(map[int][]string)
+	ForEachClient(func(client *models.Client) {
+		users[client.TenantID] = append(users[client.TenantID], client.DisplayName)
+	})
+	return users
+}
+
+// Presence statuses
+const (
+	StatusActive = "active"
+	StatusIdle   = "idle"
+)
+
+// IdleAfter is how long a user can go without sending anything on any connection before they are idle
+const IdleAfter = 5 * time.Minute
+
+// CollectPresence returns the presence of each user connected to a tenant, grouping their connections.
+// Only connections to this instance are included.
+func CollectPresence(tenantID int, now time.Time) []models.Presence {
+	byUser := make(map[string]*models.Presence)
+	ForEachClient(func(client *models.Client) {
+		if client.TenantID != tenantID {
+			return
+		}
+
+		// Guests have no user ID, so are told apart by their generated names
+		key := "user:" + strconv.Itoa(client.UserID)
+		if client.UserID == 0 {
+			key = "guest:" + client.DisplayName
+		}
+		presence, ok := byUser[key]
+		if !ok {
+			presence = &models.Presence{Username: client.DisplayName, Guest: client.UserID == 0}
+			byUser[key] = presence
+		}
+		presence.Devices++
+		if lastActive := client.LastActive(); lastActive.After(presence.LastActiveAt) {
+			presence.LastActiveAt = lastActive
+		}
+	})
+
+	users := make([]models.Presence, 0, len(byUser))
+	for _, presence := range byUser {
+		presence.Status = StatusActive
+		if now.Sub(presence.LastActiveAt) >= IdleAfter {
+			presence.Status = StatusIdle
+		}
+		users = append(users, *presence)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users
+}
+
+// GetClientByID finds an active client by its connection ID.
+func GetClientByID(id string) (*models.Client, bool) {
+	shard := shardFor(id)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	client, ok := shard.clients[id]
+	return client, ok
+}
+
+// IsUserOnline reports whether a user has any active connections.
+func IsUserOnline(tenantID, userID int) bool {
+	online := false
+	ForEachClient(func(client *models.Client) {
+		if client.TenantID == tenantID && client.UserID == userID {
+			online = true
+		}
+	})
+	return online
+}
+
+// CountClients returns the number of active clients across all tenants.
+func CountClients() int {
+	count := 0
+	for i := range clientShards {
+		shard := &clientShards[i]
+		shard.mu.RLock()
+		count += len(shard.clients)
+		shard.mu.RUnlock()
+	}
+	return count
+}
+
+// CloseClient sends a client a close frame with the given code and reason, then closes its connection.
+// The client's read loop then deregisters it.
+func CloseClient(client *models.Client, code int, reason string) {
+	closeMessage := websocket.FormatCloseMessage(code, reason)
+	client.Conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+	client.Conn.Close()
+}
+
+// CloseUserConnections closes all of a user's connections, returning how many were closed.
+// Each is sent a close frame with the reason, and its read loop then deregisters it, removing the user's presence.
+func CloseUserConnections(tenantID, userID int, reason string) int {
+	var connections []*models.Client
+	ForEachClient(func(client *models.Client) {
+		if client.TenantID == tenantID && client.UserID == userID {
+			connections = append(connections, client)
+		}
+	})
+
+	for _, client := range connections {
+		CloseClient(client, websocket.ClosePolicyViolation, reason)
+	}
+	return len(connections)
+}
+
+// CollectStats returns the connection and queue figures of each tenant's clients, keyed by tenant ID.
+// Guests have no user ID, so each guest connection counts as a separate user.
+func CollectStats(now time.Time) map[int]*models.Stats {
+	stats := make(map[int]*models.Stats)
+	users := make(map[int]map[int]bool) // Users seen per tenant
+	ForEachClient(func(client *models.Client) {
+		tenantStats := stats[client.TenantID]
+		if tenantStats == nil {
+			tenantStats = &models.Stats{Type: protocol.TypeStats, Timestamp: now}
+			stats[client.TenantID] = tenantStats
+			users[client.TenantID] = make(map[int]bool)
+		}
+
+		tenantStats.Connections++
+		if client.UserID == 0 || !users[client.TenantID][client.UserID] {
+			tenantStats.ConnectedUsers++
+			users[client.TenantID][client.UserID] = true
+		}
+
+		queued := len(client.Send)
+		tenantStats.QueueDepth += queued
+		tenantStats.MaxQueueDepth = max(tenantStats.MaxQueueDepth, queued)
+	})
+	return stats
+}
+
+// CollectConnections returns information on the active connections of a tenant.
+func CollectConnections(tenantID int, now time.Time) []models.ConnectionInfo {
+	connections := []models.ConnectionInfo{}
+	ForEachClient(func(client *models.Client) {
+		if client.TenantID != tenantID {
+			return
+		}
+		connections = append(connections, models.ConnectionInfo{
+			ID:                client.ID,
+			Username:          client.DisplayName,
+			IP:                client.IP,
+			ConnectedAt:       client.ConnectedAt,
+			MessagesPerMinute: client.MessagesPerMinute(now),
+		})
+	})
+	return connections
+}
@@ -0,0 +1,187 @@
+package utils
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-chat-app/models"
+)
+
+// singleMutexClients is the previous client pool, a single map behind one mutex, kept as a benchmark baseline.
+type singleMutexClients struct {
+	mu      sync.Mutex
+	clients map[*models.Client]bool
+}
+
+func (s *singleMutexClients) add(client *models.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[client] = true
+}
+
+func (s *singleMutexClients) remove(client *models.Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, client)
+}
+
+func (s *singleMutexClients) forEach(fn func(*models.Client)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for client := range s.clients {
+		fn(client)
+	}
+}
+
+// resetClients empties the sharded pool between tests.
+func resetClients() {
+	clientShards = newClientShards()
+}
+
+func makeTestClients(n int) []*models.Client {
+	clients := make([]*models.Client, n)
+	for i := range clients {
+		clients[i] = &models.Client{ID: "client-" + strconv.Itoa(i), TenantID: 1 + i%4}
+	}
+	return clients
+}
+
+func TestShardedClients(t *testing.T) {
+	resetClients()
+	clients := makeTestClients(100)
+	for _, client := range clients {
+		addClient(client)
+	}
+
+	count := 0
+	ForEachClient(func(*models.Client) { count++ })
+	if count != 100 {
+		t.Fatalf("expected 100 clients, got %d", count)
+	}
+
+	if found, ok := GetClientByID("client-42"); !ok || found != clients[42] {
+		t.Errorf("expected to find client-42, got %v %v", found, ok)
+	}
+
+	if !removeClient(clients[42]) {
+		t.Error("expected client-42 to be removed")
+	}
+	if removeClient(clients[42]) {
+		t.Error("expected removing client-42 twice to report it wasn't registered")
+	}
+	if _, ok := GetClientByID("client-42"); ok {
+		t.Error("expected client-42 to be gone")
+	}
+}
+
+func TestCollectPresence(t *testing.T) {
+	resetClients()
+	now := time.Now()
+	phone := &models.Client{ID: "phone", TenantID: 1, UserID: 7, DisplayName: "alice", ConnectedAt: now.Add(-time.Hour)}
+	laptop := &models.Client{ID: "laptop", TenantID: 1, UserID: 7, DisplayName: "alice", ConnectedAt: now.Add(-time.Hour)}
+	bob := &models.Client{ID: "bob", TenantID: 1, UserID: 8, DisplayName: "bob", ConnectedAt: now.Add(-time.Hour)}
+	guest := &models.Client{ID: "guest", TenantID: 1, DisplayName: "Anonymous-1", ConnectedAt: now}
+	other := &models.Client{ID: "other", TenantID: 2, UserID: 9, DisplayName: "carol", ConnectedAt: now}
+	for _, client := range []*models.Client{phone, laptop, bob, guest, other} {
+		addClient(client)
+	}
+	laptop.RecordActivity(now.Add(-time.Minute))
+
+	presence := CollectPresence(1, now)
+	if len(presence) != 3 {
+		t.Fatalf("expected 3 users in tenant 1, got %+v", presence)
+	}
+
+	// Sorted by username: Anonymous-1, alice, bob
+	if presence[0].Username != "Anonymous-1" || !presence[0].Guest || presence[0].Status != StatusActive {
+		t.Errorf("expected an active guest, got %+v", presence[0])
+	}
+	if presence[1].Username != "alice" || presence[1].Devices != 2 || presence[1].Status != StatusActive {
+		t.Errorf("expected alice active on 2 devices, got %+v", presence[1])
+	}
+	if presence[2].Username != "bob" || presence[2].Status != StatusIdle {
+		t.Errorf("expected bob to be idle, got %+v", presence[2])
+	}
+}
+
+// The benchmarks simulate fan-out to 10,000 connected clients while other goroutines connect and disconnect.
+// Compare with: go test ./utils -bench . -benchmem
+
+const benchConnected = 10000
+
+func BenchmarkChurnDuringFanOut_SingleMutex(b *testing.B) {
+	pool := &singleMutexClients{clients: make(map[*models.Client]bool)}
+	for _, client := range makeTestClients(benchConnected) {
+		pool.add(client)
+	}
+	benchChurnDuringFanOut(b, pool.add, pool.remove, pool.forEach)
+}
+
+func BenchmarkChurnDuringFanOut_Sharded(b *testing.B) {
+	resetClients()
+	for _, client := range makeTestClients(benchConnected) {
+		addClient(client)
+	}
+	benchChurnDuringFanOut(b, addClient, func(c *models.Client) { removeClient(c) }, ForEachClient)
+}
+
+// benchChurnDuringFanOut measures register/deregister throughput (ns/op) while a fan-out loop continuously walks the
+// pool, also reporting how many fan-out passes completed. Lock contention only shows up with several CPUs.
+func benchChurnDuringFanOut(b *testing.B, add, remove func(*models.Client), forEach func(func(*models.Client))) {
+	var stop atomic.Bool
+	var fanOuts atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for !stop.Load() {
+			forEach(func(client *models.Client) { _ = client.TenantID })
+			fanOuts.Add(1)
+		}
+	}()
+
+	var next atomic.Int64
+	start := time.Now()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			client := &models.Client{ID: "churn-" + strconv.FormatInt(next.Add(1), 10)}
+			add(client)
+			remove(client)
+		}
+	})
+	b.StopTimer()
+
+	stop.Store(true)
+	wg.Wait()
+	b.ReportMetric(float64(fanOuts.Load())/time.Since(start).Seconds(), "fanouts/s")
+}
+
+func TestForEachClient_UnlocksAfterPanic(t *testing.T) {
+	client := &models.Client{ID: "panicky", TenantID: 1}
+	addClient(client)
+	defer removeClient(client)
+
+	func() {
+		defer Recover("test")
+		ForEachClient(func(c *models.Client) {
+			panic("boom")
+		})
+	}()
+
+	// Registering takes the write lock, which would deadlock if the panic left a shard read locked
+	done := make(chan struct{})
+	go func() {
+		other := &models.Client{ID: "panicky", TenantID: 1}
+		addClient(other)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("shard still locked after a panic in ForEachClient")
+	}
+}
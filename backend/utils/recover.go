@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// Guardrails for long running goroutines. A panic that isn't recovered in the goroutine it happens in crashes the
+// whole process, disconnecting every client, so per-connection goroutines and the hub's listeners recover and log
+// panics instead.
+
+// Recover recovers from a panic and logs it with its stack trace, describing where it happened with a format string.
+// It only works when deferred directly:
+//
+//	defer utils.Recover("heartbeat for user %d", userID)
+func Recover(format string, args ...any) {
+	if p := recover(); p != nil {
+		LogPanic(p, format, args...)
+	}
+}
+
+// LogPanic logs a recovered panic with its stack trace.
+func LogPanic(p any, format string, args ...any) {
+	log.Printf("Recovered from panic in %s: %v\n%s", fmt.Sprintf(format, args...), p, debug.Stack())
+}
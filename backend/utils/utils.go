@@ -1,23 +1,26 @@
 package utils
 
 import (
+	"go-chat-app/frames"
 	"go-chat-app/models"
+	"go-chat-app/protocol"
+	"net"
 	"net/http"
-	"sync"
+	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
 var (
-	clients       = make(map[*models.Client]bool)
-	broadcast     = make(chan models.Message)
+	broadcast     = make(chan models.OutboundMessage)
 	notifyClients = make(chan struct{})
-	mutex         sync.Mutex
 )
 
+// sendQueueSize is how many outbound frames can queue for a client before it is treated as unresponsive
+const sendQueueSize = 64
+
 // GetBroadcastChannel returns the broadcast channel.
-func GetBroadcastChannel() chan models.Message {
+func GetBroadcastChannel() chan models.OutboundMessage {
 	return broadcast
 }
 
@@ -26,50 +29,36 @@ func GetNotifyClientsChannel() chan struct{} {
 	return notifyClients
 }
 
-// GetClients returns a reference to the clients map with the mutex.
-func GetClients() (map[*models.Client]bool, *sync.Mutex) {
-	return clients, &mutex
-}
-
 // MakeClient does the setup of the client object such as name, id, etc.
-func MakeClient(r *http.Request, ws *websocket.Conn, user *models.User) *models.Client {
-	displayName := user.Username
+func MakeClient(r *http.Request, ws *websocket.Conn, user *models.User, id string, connectedAt time.Time) *models.Client {
+	displayName := user.DisplayName
+	if displayName == "" {
+		displayName = user.Username
+	}
 	if displayName == "" {
 		displayName = "Anonymous"
 	}
 
 	client := &models.Client{
-		ID:          uuid.New().String(),
+		ID:          id,
+		TenantID:    user.TenantID,
+		UserID:      user.ID,
 		DisplayName: displayName,
+		IsAdmin:     user.IsAdmin,
+		IP:          ClientIP(r),
+		ConnectedAt: connectedAt,
 		Conn:        ws,
-		Send:        make(chan []byte),
+		Send:        make(chan *frames.Frame, sendQueueSize),
 	}
+	client.SetCapabilities(protocol.LegacyCapabilities()) // Until the client sends a hello frame
 	return client
 }
 
-// RegisterClient adds a client to the active client pool.
-func RegisterClient(client *models.Client) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	clients[client] = true
-	notifyClients <- struct{}{}
-}
-
-// DeregisterClient removes a client from the active client pool.
-func DeregisterClient(client *models.Client) {
-	mutex.Lock()
-	defer mutex.Unlock()
-	delete(clients, client)
-	notifyClients <- struct{}{}
-}
-
-// CollectActiveUsers returns a list of display names of active clients.
-func CollectActiveUsers() []string {
-	mutex.Lock()
-	defer mutex.Unlock()
-	users := []string{}
-	for client := range clients {
-		users = append(users, client.DisplayName)
+// ClientIP returns the IP address a request came from.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
-	return users
+	return host
 }
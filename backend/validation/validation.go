@@ -0,0 +1,138 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"go-chat-app/apierror"
+	"go-chat-app/usernames"
+)
+
+// Validation for request bodies. Endpoints accept either form-encoded or JSON bodies, so a Validator first reads
+// the body into a set of string fields, then checks are run against those fields and any failures are collected
+// so the client can be told about every problem at once.
+
+// maxBodyBytes limits how much of a request body is read when decoding JSON.
+const maxBodyBytes = 1 << 20
+
+// FieldError describes a problem with a single field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validator holds the fields of a request body and any field errors found so far.
+type Validator struct {
+	fields map[string]string
+	errors []FieldError
+}
+
+// New reads the request body, JSON or form-encoded depending on the Content-Type, into a Validator.
+func New(r *http.Request) (*Validator, error) {
+	v := &Validator{fields: make(map[string]string)}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		var body map[string]any
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxBodyBytes)).Decode(&body); err != nil {
+			return nil, fmt.Errorf("invalid JSON body: %w", err)
+		}
+		for name, value := range body {
+			switch value := value.(type) {
+			case string:
+				v.fields[name] = value
+			case float64, bool:
+				v.fields[name] = fmt.Sprint(value)
+			default:
+				v.AddError(name, "must be a string")
+			}
+		}
+		return v, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("invalid form body: %w", err)
+	}
+	for name := range r.Form {
+		v.fields[name] = r.FormValue(name)
+	}
+	return v, nil
+}
+
+// Get returns the value of a field, or an empty string if it wasn't sent.
+func (v *Validator) Get(field string) string {
+	return v.fields[field]
+}
+
+// AddError records an error against a field.
+func (v *Validator) AddError(field, message string) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: message})
+}
+
+// Check records an error against a field if ok is false.
+func (v *Validator) Check(ok bool, field, message string) {
+	if !ok {
+		v.AddError(field, message)
+	}
+}
+
+// Required checks that each of the fields is present and not blank.
+func (v *Validator) Required(fields ...string) {
+	for _, field := range fields {
+		v.Check(strings.TrimSpace(v.fields[field]) != "", field, "is required")
+	}
+}
+
+// Username normalises a username field and checks it against the username rules.
+func (v *Validator) Username(field string, rules usernames.Rules) {
+	username := usernames.Normalize(v.fields[field])
+	v.fields[field] = username
+
+	if message, ok := rules.Validate(username); !ok {
+		v.AddError(field, message)
+	}
+}
+
+// Password checks a password is strong enough. bcrypt ignores anything past 72 bytes so longer passwords are rejected.
+func (v *Validator) Password(field string) {
+	password := v.fields[field]
+	switch {
+	case len(password) < 8:
+		v.AddError(field, "must be at least 8 characters")
+	case len(password) > 72:
+		v.AddError(field, "must be at most 72 bytes")
+	case strings.Count(password, password[:1]) == len(password):
+		v.AddError(field, "must not be a single repeated character")
+	}
+}
+
+// Valid reports whether all checks passed.
+func (v *Validator) Valid() bool {
+	return len(v.errors) == 0
+}
+
+// Errors returns the field errors found.
+func (v *Validator) Errors() []FieldError {
+	return v.errors
+}
+
+// WriteError sends the field errors to the client in the JSON error envelope with the given status.
+func (v *Validator) WriteError(w http.ResponseWriter, status int) {
+	apierror.WriteDetails(w, status, apierror.CodeValidationFailed, "Validation failed", v.errors)
+}
+
+// WriteBodyError sends the error for a request body that couldn't be read.
+// Bodies over the route's size limit get a 413.
+func WriteBodyError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		apierror.Write(w, http.StatusRequestEntityTooLarge, apierror.CodePayloadTooLarge, "Request body is too large")
+		return
+	}
+	apierror.Write(w, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+}
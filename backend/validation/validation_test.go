@@ -0,0 +1,88 @@
+package validation_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go-chat-app/usernames"
+	"go-chat-app/validation"
+)
+
+func newFormValidator(t *testing.T, body string) *validation.Validator {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	v, err := validation.New(req)
+	if err != nil {
+		t.Fatalf("unexpected error reading body: %v", err)
+	}
+	return v
+}
+
+func TestUsername(t *testing.T) {
+	tests := map[string]bool{
+		"user1":                 true,
+		"first.last-name_2":     true,
+		"":                      false,
+		"has space":             false,
+		"emoji😀":                false,
+		strings.Repeat("a", 33): false,
+	}
+
+	for username, valid := range tests {
+		t.Run(username, func(t *testing.T) {
+			v := newFormValidator(t, "username="+url.QueryEscape(username))
+			v.Username("username", usernames.DefaultRules())
+			if v.Valid() != valid {
+				t.Errorf("expected valid=%v for %q, got errors %+v", valid, username, v.Errors())
+			}
+		})
+	}
+}
+
+func TestPassword(t *testing.T) {
+	tests := map[string]bool{
+		"securepassword":         true,
+		"short":                  false,
+		"aaaaaaaaaa":             false,
+		strings.Repeat("ab", 37): false,
+	}
+
+	for password, valid := range tests {
+		t.Run(password, func(t *testing.T) {
+			v := newFormValidator(t, "password="+password)
+			v.Password("password")
+			if v.Valid() != valid {
+				t.Errorf("expected valid=%v for %q, got errors %+v", valid, password, v.Errors())
+			}
+		})
+	}
+}
+
+func TestNew_JSONBody(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username": "user1", "age": 3, "tags": ["a"]}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	v, err := validation.New(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if v.Get("username") != "user1" || v.Get("age") != "3" {
+		t.Errorf("expected string fields to be read, got username=%q age=%q", v.Get("username"), v.Get("age"))
+	}
+	if v.Valid() {
+		t.Error("expected an error for the non-string tags field")
+	}
+}
+
+func TestNew_InvalidJSON(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"username":`))
+	req.Header.Set("Content-Type", "application/json")
+
+	if _, err := validation.New(req); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
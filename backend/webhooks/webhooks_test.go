@@ -0,0 +1,44 @@
+package webhooks_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"go-chat-app/webhooks"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"sender":"deploy-bot","content":"Deployed v1.2"}`)
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signature := webhooks.Sign("secret", now, body)
+
+	if err := webhooks.Verify("secret", timestamp, signature, body, now.Add(time.Minute)); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      []byte
+		want      error
+	}{
+		{"missing signature", "secret", timestamp, "", body, webhooks.ErrMissingSignature},
+		{"wrong secret", "other", timestamp, signature, body, webhooks.ErrBadSignature},
+		{"tampered body", "secret", timestamp, signature, []byte(`{"content":"rm -rf"}`), webhooks.ErrBadSignature},
+		{"tampered timestamp", "secret", strconv.FormatInt(now.Unix()+1, 10), signature, body, webhooks.ErrBadSignature},
+		{"unknown algorithm", "secret", timestamp, "md5=abc", body, webhooks.ErrBadSignature},
+		{"replayed", "secret", strconv.FormatInt(now.Add(-time.Hour).Unix(), 10), signature, body, webhooks.ErrStaleTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := webhooks.Verify(tt.secret, tt.timestamp, tt.signature, tt.body, now); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
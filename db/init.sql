@@ -2,21 +2,129 @@ CREATE DATABASE IF NOT EXISTS chatapp;
 
 USE chatapp;
 
+-- Tenants table. Each tenant is an isolated chat instance resolved by hostname or API key
+CREATE TABLE IF NOT EXISTS tenants (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    hostname VARCHAR(255) NULL UNIQUE,                              -- Hostname requests for this tenant are sent to
+    api_key VARCHAR(255) NULL UNIQUE,                               -- API key for bots and integrations
+    webhook_secret VARCHAR(255) NULL,                               -- HMAC key inbound webhook messages must be signed with
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Default tenant used when no other tenant matches
+INSERT IGNORE INTO tenants (id, name) VALUES (1, 'default');
+
+-- Message of the day shown to users when they connect, set by tenant admins
+CREATE TABLE IF NOT EXISTS motd (
+    tenant_id INT PRIMARY KEY,
+    message TEXT NOT NULL,
+    updated_by VARCHAR(255) NOT NULL,                               -- Username of the admin who last set it
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id)
+);
+
 -- Messages table
 CREATE TABLE IF NOT EXISTS messages (
-    id INT AUTO_INCREMENT PRIMARY KEY,
+    id BIGINT PRIMARY KEY,                                          -- Snowflake ID assigned when the message was received, sorts in send order
+    tenant_id INT NOT NULL DEFAULT 1,
     sender VARCHAR(255) NOT NULL,
-    content TEXT NOT NULL,
-    timestamp DATETIME NOT NULL
+    type VARCHAR(32) NOT NULL DEFAULT '',                           -- Empty for plain chat messages, "code" for code snippets
+    language VARCHAR(64) NOT NULL DEFAULT '',                       -- Language of a code snippet
+    content TEXT NOT NULL,                                          -- Message text, or the raw source of a code snippet
+    highlighted MEDIUMTEXT NULL,                                    -- Server highlighted HTML of a code snippet
+    verified BOOLEAN NOT NULL DEFAULT FALSE,                        -- Posted by a bot or integration with a valid signature
+    timestamp DATETIME NOT NULL,
+    INDEX idx_messages_tenant_timestamp (tenant_id, timestamp),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id)
 );
 
 -- Users table
 CREATE TABLE IF NOT EXISTS users (
     id INT AUTO_INCREMENT PRIMARY KEY,                              -- Unique identifier for each user
-    username VARCHAR(255) NOT NULL UNIQUE,                          -- Username (must be unique)
+    tenant_id INT NOT NULL DEFAULT 1,                               -- Tenant the user belongs to
+    username VARCHAR(255) NOT NULL,                                 -- Username as displayed (NFKC normalised)
+    username_key VARCHAR(255) NOT NULL,                             -- Lowercased username used for case-insensitive uniqueness
+    display_name VARCHAR(64) NULL,                                  -- Shown instead of the username when set, checked for lookalikes
+    email VARCHAR(255) NULL,                                        -- Where emails such as transcripts are sent
     hashed_password VARCHAR(255) NOT NULL,                          -- Password hash
     session_token VARCHAR(255) NOT NULL DEFAULT '',                 -- Session token for authentication
     csrf_token VARCHAR(255) NOT NULL DEFAULT '',                    -- CSRF token for request validation
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE,                        -- Tenant admin. Granted manually, e.g. UPDATE users SET is_admin = TRUE WHERE ...
+    last_seen_at DATETIME NULL,                                     -- Updated while connected and on disconnect
+    preferences JSON NULL,                                          -- Personal settings such as Do Not Disturb windows
+    deactivated_at DATETIME NULL,                                   -- Set while the account is deactivated, which blocks logging in
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,                  -- Account creation timestamp
-    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP -- Last update timestamp
-);
\ No newline at end of file
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, -- Last update timestamp
+    UNIQUE KEY uq_users_tenant_username (tenant_id, username_key),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id)
+);
+-- Scheduled events, announced in the chat when they start with a reminder beforehand
+CREATE TABLE IF NOT EXISTS events (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL DEFAULT 1,
+    title VARCHAR(255) NOT NULL,
+    starts_at DATETIME NOT NULL,
+    created_by VARCHAR(255) NOT NULL,
+    reminded BOOLEAN NOT NULL DEFAULT FALSE,                        -- Reminder sent before the event
+    announced BOOLEAN NOT NULL DEFAULT FALSE,                       -- Announced when the event started
+    cancelled BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_events_pending (announced, cancelled, starts_at),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id)
+);
+
+-- Outbox cursors. The messages table doubles as an outbox; each sink records the last message it delivered
+CREATE TABLE IF NOT EXISTS outbox_cursors (
+    sink VARCHAR(64) PRIMARY KEY,                                   -- Sink name, e.g. kafka
+    last_message_id BIGINT NOT NULL DEFAULT 0,                      -- ID of the last message delivered to the sink
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+-- Message archives. Pages of old messages moved out of the messages table into cold storage (gzipped NDJSON in S3)
+CREATE TABLE IF NOT EXISTS message_archives (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    tenant_id INT NOT NULL,
+    object_key VARCHAR(512) NOT NULL UNIQUE,                        -- Key of the archive object in the bucket
+    first_message_id BIGINT NOT NULL,
+    last_message_id BIGINT NOT NULL,
+    from_timestamp DATETIME NOT NULL,                               -- Timestamp of the oldest message in the page
+    to_timestamp DATETIME NOT NULL,                                 -- Timestamp of the newest message in the page
+    message_count INT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_message_archives_tenant (tenant_id, first_message_id),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id)
+);
+
+-- Message reactions. Each user can react to a message with each emoji once; reacting again removes it
+CREATE TABLE IF NOT EXISTS message_reactions (
+    message_id BIGINT NOT NULL,
+    user_id INT NOT NULL,
+    emoji VARCHAR(64) NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id, emoji),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Feature flags. A tenant's setting for a flag; flags without a row use the instance defaults
+CREATE TABLE IF NOT EXISTS feature_flags (
+    tenant_id INT NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,                         -- Off for everyone when false
+    percentage TINYINT NOT NULL DEFAULT 100,                        -- Share of users the flag is on for when enabled, 0 to 100
+    updated_by VARCHAR(255) NOT NULL,                               -- Username of the admin who last changed it
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, name),
+    FOREIGN KEY (tenant_id) REFERENCES tenants(id)
+);
+
+-- Users a feature flag is always on for while it's enabled, whatever its percentage
+CREATE TABLE IF NOT EXISTS feature_flag_users (
+    tenant_id INT NOT NULL,
+    name VARCHAR(64) NOT NULL,
+    user_id INT NOT NULL,
+    PRIMARY KEY (tenant_id, name, user_id),
+    FOREIGN KEY (tenant_id, name) REFERENCES feature_flags(tenant_id, name) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
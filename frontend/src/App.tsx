@@ -9,6 +9,24 @@ type Message = {
   timestamp: string;
 };
 
+// Reads the human readable message from the backend's JSON error envelope
+const errorMessage = async (response: Response): Promise<string> => {
+  try {
+    const body = await response.json();
+    if (Array.isArray(body.details)) {
+      // Field-level validation errors, e.g. "password must be at least 8 characters"
+      const fieldErrors = body.details.map(
+        (detail: { field: string; message: string }) =>
+          `${detail.field} ${detail.message}`
+      );
+      return `${body.message}: ${fieldErrors.join(", ")}`;
+    }
+    return body.message ?? response.statusText;
+  } catch {
+    return response.statusText;
+  }
+};
+
 const App: React.FC = () => {
   const [username, setUsername] = useState<string>("");
   const [password, setPassword] = useState<string>("");
@@ -19,8 +37,27 @@ const App: React.FC = () => {
   const [showLoginPopup, setShowLoginPopup] = useState<boolean>(true);
 
   const ws = useRef<WebSocket | null>(null);
+  const embed = useRef<{ origin: string; key: string } | null>(null);
   const ipAddress = window.location.hostname;
 
+  // When embedded in an iframe, the parent page hands over its embed key using postMessage.
+  // event.origin is set by the browser so it can be trusted as the embedding site's origin.
+  useEffect(() => {
+    if (window.parent === window) {
+      return;
+    }
+
+    const handleEmbedMessage = (event: MessageEvent) => {
+      if (event.data?.type === "go-chat-embed" && event.data.embedKey) {
+        embed.current = { origin: event.origin, key: event.data.embedKey };
+      }
+    };
+
+    window.addEventListener("message", handleEmbedMessage);
+    window.parent.postMessage({ type: "go-chat-ready" }, "*");
+    return () => window.removeEventListener("message", handleEmbedMessage);
+  }, []);
+
   // Automatically connect the user in if they already have valid session tokens
   useEffect(() => {
     const checkSession = async () => {
@@ -96,7 +133,7 @@ const App: React.FC = () => {
         alert("Registration successful! Logging you in...");
         handleLogin(); // Automatically log in after registration
       } else {
-        const errorText = await response.text();
+        const errorText = await errorMessage(response);
         alert(`Registration failed: ${errorText}`);
       }
     } catch (error) {
@@ -130,7 +167,7 @@ const App: React.FC = () => {
           );
         }
       } else {
-        const errorText = await response.text();
+        const errorText = await errorMessage(response);
         alert(`Login failed: ${errorText}`);
       }
     } catch (error) {
@@ -163,7 +200,7 @@ const App: React.FC = () => {
         setActiveUsers([]);
         setShowLoginPopup(true);
       } else {
-        const errorText = await response.text();
+        const errorText = await errorMessage(response);
         alert(`Logout failed: ${errorText}`);
       }
     } catch (error) {
@@ -200,9 +237,13 @@ const App: React.FC = () => {
       return;
     }
 
-    ws.current = new WebSocket(
-      `ws://${ipAddress}:8080/ws?csrf_token=${csrfToken}`
-    );
+    let wsUrl = `ws://${ipAddress}:8080/ws?csrf_token=${csrfToken}`;
+    if (embed.current) {
+      wsUrl += `&embed_origin=${encodeURIComponent(
+        embed.current.origin
+      )}&embed_key=${encodeURIComponent(embed.current.key)}`;
+    }
+    ws.current = new WebSocket(wsUrl);
 
     ws.current.onmessage = (event: MessageEvent) => {
       const data = JSON.parse(event.data);